@@ -37,11 +37,33 @@ func main() {
 	userRepo := repository.NewUserRepository(db)
 	groupRepo := repository.NewGroupRepository(db)
 	expenseRepo := repository.NewExpenseRepository(db)
+	invitationRepo := repository.NewInvitationRepository(db)
+	joinLinkRepo := repository.NewJoinLinkRepository(db)
+	rateRepo := repository.NewExchangeRateRepository(db)
+
+	// Purge expenses that have been in the trash longer than the retention period
+	trashConfig := config.NewTrashConfig()
+	go func() {
+		ticker := time.NewTicker(trashConfig.PurgeInterval)
+		defer ticker.Stop()
+		for {
+			purged, err := expenseRepo.PurgeDeleted(trashConfig.Retention)
+			if err != nil {
+				logger.Printf("Error purging trash: %v", err)
+			} else if purged > 0 {
+				logger.Printf("Purged %d expenses from the trash", purged)
+			}
+			<-ticker.C
+		}
+	}()
 
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(userRepo)
-	groupHandler := handlers.NewGroupHandler(groupRepo)
-	expenseHandler := handlers.NewExpenseHandler(expenseRepo, groupRepo)
+	userHandler := handlers.NewUserHandler(userRepo, invitationRepo)
+	groupHandler := handlers.NewGroupHandler(groupRepo, userRepo, expenseRepo)
+	expenseHandler := handlers.NewExpenseHandler(expenseRepo, groupRepo, userRepo, rateRepo)
+	settlementHandler := handlers.NewSettlementHandler(expenseRepo, groupRepo)
+	invitationHandler := handlers.NewInvitationHandler(invitationRepo, groupRepo, userRepo)
+	joinLinkHandler := handlers.NewJoinLinkHandler(joinLinkRepo, groupRepo)
 
 	// Initialize router
 	router := mux.NewRouter()
@@ -66,12 +88,54 @@ func main() {
 	// Group routes
 	api.HandleFunc("/groups", groupHandler.Create).Methods(http.MethodPost)
 	api.HandleFunc("/groups", groupHandler.GetUserGroups).Methods(http.MethodGet)
-	api.HandleFunc("/groups/{id}", groupHandler.GetByID).Methods(http.MethodGet)
+
+	// Routes below /groups/{id} are only available to members of the group
+	group := api.PathPrefix("/groups/{id}").Subrouter()
+	group.Use(middleware.GroupMemberMiddleware(groupRepo))
+	group.HandleFunc("", groupHandler.GetByID).Methods(http.MethodGet)
+	group.HandleFunc("", groupHandler.Update).Methods(http.MethodPatch)
+	group.HandleFunc("/archive", groupHandler.Archive).Methods(http.MethodPost)
+	group.HandleFunc("/unarchive", groupHandler.Unarchive).Methods(http.MethodPost)
+	group.HandleFunc("/members", groupHandler.AddMember).Methods(http.MethodPost)
+	group.HandleFunc("/members/{userId}", groupHandler.RemoveMember).Methods(http.MethodDelete)
+	group.HandleFunc("/members/{userId}/role", groupHandler.SetRole).Methods(http.MethodPut)
+	group.HandleFunc("/transfer-ownership", groupHandler.TransferOwnership).Methods(http.MethodPost)
+	group.HandleFunc("/leave", groupHandler.Leave).Methods(http.MethodPost)
+	group.HandleFunc("/guests", groupHandler.AddGuest).Methods(http.MethodPost)
+	group.HandleFunc("/guests/{guestId}/merge", groupHandler.MergeGuest).Methods(http.MethodPost)
 
 	// Expense routes
 	api.HandleFunc("/expenses", expenseHandler.Create).Methods(http.MethodPost)
-	api.HandleFunc("/groups/{id}/expenses", expenseHandler.GetGroupExpenses).Methods(http.MethodGet)
-	api.HandleFunc("/groups/{id}/balance", expenseHandler.GetBalanceSheet).Methods(http.MethodGet)
+	api.HandleFunc("/expenses/{id}", expenseHandler.GetByID).Methods(http.MethodGet)
+	api.HandleFunc("/expenses/{id}", expenseHandler.Update).Methods(http.MethodPut)
+	api.HandleFunc("/expenses/{id}", expenseHandler.Patch).Methods(http.MethodPatch)
+	api.HandleFunc("/expenses/{id}", expenseHandler.Delete).Methods(http.MethodDelete)
+	api.HandleFunc("/expenses/{id}/restore", expenseHandler.Restore).Methods(http.MethodPost)
+	api.HandleFunc("/expenses/{id}/history", expenseHandler.History).Methods(http.MethodGet)
+	group.HandleFunc("/expenses", expenseHandler.GetGroupExpenses).Methods(http.MethodGet)
+	group.HandleFunc("/trash", expenseHandler.GetGroupTrash).Methods(http.MethodGet)
+	group.HandleFunc("/balance", expenseHandler.GetBalanceSheet).Methods(http.MethodGet)
+	group.HandleFunc("/settle-plan", expenseHandler.GetSettlePlan).Methods(http.MethodGet)
+
+	// Settlement routes
+	group.HandleFunc("/settlements", settlementHandler.Create).Methods(http.MethodPost)
+	group.HandleFunc("/settlements", settlementHandler.GetGroupSettlements).Methods(http.MethodGet)
+
+	// Invitation routes
+	group.HandleFunc("/invitations", invitationHandler.Create).Methods(http.MethodPost)
+	group.HandleFunc("/invitations", invitationHandler.GetGroupInvitations).Methods(http.MethodGet)
+	group.HandleFunc("/invitations/{invitationId}", invitationHandler.Revoke).Methods(http.MethodDelete)
+	api.HandleFunc("/invitations", invitationHandler.GetMine).Methods(http.MethodGet)
+	api.HandleFunc("/invitations/accept", invitationHandler.Accept).Methods(http.MethodPost)
+
+	// Join link routes
+	group.HandleFunc("/join-links", joinLinkHandler.Create).Methods(http.MethodPost)
+	group.HandleFunc("/join-links", joinLinkHandler.GetGroupLinks).Methods(http.MethodGet)
+	group.HandleFunc("/join-links/{linkId}", joinLinkHandler.Revoke).Methods(http.MethodDelete)
+	group.HandleFunc("/join-requests", joinLinkHandler.GetPendingRequests).Methods(http.MethodGet)
+	group.HandleFunc("/join-requests/{requestId}/approve", joinLinkHandler.Approve).Methods(http.MethodPost)
+	group.HandleFunc("/join-requests/{requestId}/reject", joinLinkHandler.Reject).Methods(http.MethodPost)
+	api.HandleFunc("/join", joinLinkHandler.Join).Methods(http.MethodPost)
 
 	// Configure server
 	srv := &http.Server{
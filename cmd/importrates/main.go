@@ -0,0 +1,100 @@
+// Command importrates loads exchange rates from a local file into the
+// database, so expenses in foreign currencies can be converted without
+// network access.
+//
+// Usage:
+//
+//	importrates [-db expense_sharing.db] [-format csv|ecb] <file>
+//
+// The format defaults to ecb for .xml files and csv otherwise.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"expense-sharing-api/internal/config"
+	"expense-sharing-api/internal/repository"
+	"expense-sharing-api/pkg/rates"
+)
+
+func main() {
+	logger := log.New(os.Stderr, "IMPORT-RATES ", log.LstdFlags)
+
+	dbConfig := config.NewDBConfig()
+	flag.StringVar(&dbConfig.DBPath, "db", dbConfig.DBPath, "path to the database")
+	format := flag.String("format", "", "file format, csv or ecb (default: by file extension)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <file>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	if *format == "" {
+		*format = "csv"
+		if strings.EqualFold(filepath.Ext(path), ".xml") {
+			*format = "ecb"
+		}
+	}
+
+	var parse func(io.Reader) ([]rates.Rate, error)
+	switch *format {
+	case "csv":
+		parse = rates.ParseCSV
+	case "ecb":
+		parse = rates.ParseECB
+	default:
+		logger.Fatalf("Unknown format %q, expected csv or ecb", *format)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer file.Close()
+
+	parsed, err := parse(file)
+	if err != nil {
+		logger.Fatalf("Error reading %s: %v", path, err)
+	}
+	if len(parsed) == 0 {
+		logger.Fatalf("No exchange rates found in %s", path)
+	}
+
+	db, err := dbConfig.Connect()
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := dbConfig.InitSchema(db); err != nil {
+		logger.Fatal(err)
+	}
+
+	imported, err := repository.NewExchangeRateRepository(db).Import(parsed)
+	if err != nil {
+		logger.Fatalf("Error importing exchange rates: %v", err)
+	}
+
+	first, last := parsed[0].Date, parsed[0].Date
+	for _, rate := range parsed {
+		if rate.Date.Before(first) {
+			first = rate.Date
+		}
+		if rate.Date.After(last) {
+			last = rate.Date
+		}
+	}
+	logger.Printf("Imported %d exchange rates from %s to %s",
+		imported, first.Format(rates.DateLayout), last.Format(rates.DateLayout))
+}
@@ -37,82 +37,254 @@ func (c *DBConfig) Connect() (*sqlx.DB, error) {
 }
 
 func (c *DBConfig) InitSchema(db *sqlx.DB) error {
-	// Create tables one by one to better handle errors
-	schemas := []string{
-		`CREATE TABLE IF NOT EXISTS users (
-            user_id INTEGER PRIMARY KEY AUTOINCREMENT,
-            email TEXT UNIQUE NOT NULL,
-            full_name TEXT NOT NULL,
-            password_hash TEXT NOT NULL,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-        );`,
-
-		`CREATE TABLE IF NOT EXISTS groups (
-            group_id INTEGER PRIMARY KEY AUTOINCREMENT,
-            name TEXT NOT NULL,
-            description TEXT,
-            created_by INTEGER NOT NULL,
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            FOREIGN KEY (created_by) REFERENCES users(user_id)
-        );`,
-
-		`CREATE TABLE IF NOT EXISTS group_members (
-            group_id INTEGER NOT NULL,
-            user_id INTEGER NOT NULL,
-            joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            PRIMARY KEY (group_id, user_id),
-            FOREIGN KEY (group_id) REFERENCES groups(group_id),
-            FOREIGN KEY (user_id) REFERENCES users(user_id)
-        );`,
-
-		`CREATE TABLE IF NOT EXISTS expenses (
-            expense_id INTEGER PRIMARY KEY AUTOINCREMENT,
-            group_id INTEGER NOT NULL,
-            description TEXT NOT NULL,
-            amount DECIMAL(10,2) NOT NULL,
-            created_by INTEGER NOT NULL,
-            split_type TEXT NOT NULL CHECK (split_type IN ('EQUAL', 'EXACT', 'PERCENTAGE')),
-            created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            FOREIGN KEY (group_id) REFERENCES groups(group_id),
-            FOREIGN KEY (created_by) REFERENCES users(user_id)
-        );`,
-
-		`CREATE TABLE IF NOT EXISTS expense_shares (
-            expense_id INTEGER NOT NULL,
-            user_id INTEGER NOT NULL,
-            share_amount DECIMAL(10,2) NOT NULL,
-            share_percentage DECIMAL(5,2),
-            paid_amount DECIMAL(10,2) DEFAULT 0,
-            PRIMARY KEY (expense_id, user_id),
-            FOREIGN KEY (expense_id) REFERENCES expenses(expense_id),
-            FOREIGN KEY (user_id) REFERENCES users(user_id)
-        );`,
-
-		`CREATE TABLE IF NOT EXISTS settlements (
-            settlement_id INTEGER PRIMARY KEY AUTOINCREMENT,
-            payer_id INTEGER NOT NULL,
-            payee_id INTEGER NOT NULL,
-            amount DECIMAL(10,2) NOT NULL,
-            group_id INTEGER NOT NULL,
-            settled_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-            notes TEXT,
-            FOREIGN KEY (payer_id) REFERENCES users(user_id),
-            FOREIGN KEY (payee_id) REFERENCES users(user_id),
-            FOREIGN KEY (group_id) REFERENCES groups(group_id)
-        );`,
-
-		`CREATE INDEX IF NOT EXISTS idx_expense_shares_expense_id ON expense_shares(expense_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_expense_shares_user_id ON expense_shares(user_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_expenses_group_id ON expenses(group_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_settlements_payer_payee ON settlements(payer_id, payee_id);`,
+	var existing int
+	err := db.Get(&existing, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'`)
+	if err != nil {
+		return fmt.Errorf("error inspecting schema: %v", err)
 	}
 
-	// Execute each schema statement separately
-	for _, schema := range schemas {
+	// Create tables one by one to better handle errors
+	for _, schema := range tables {
 		if _, err := db.Exec(schema); err != nil {
 			return fmt.Errorf("error executing schema: %v\nQuery: %s", err, schema)
 		}
 	}
 
+	// A fresh database already has the latest layout, only databases created
+	// by an earlier version need migrating
+	if existing > 0 {
+		if err := migrate(db); err != nil {
+			return err
+		}
+	} else if _, err := db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(migrations))); err != nil {
+		return fmt.Errorf("error setting schema version: %v", err)
+	}
+
+	for _, index := range indexes {
+		if _, err := db.Exec(index); err != nil {
+			return fmt.Errorf("error executing schema: %v\nQuery: %s", err, index)
+		}
+	}
+
+	for _, trigger := range triggers {
+		if _, err := db.Exec(trigger); err != nil {
+			return fmt.Errorf("error executing schema: %v\nQuery: %s", err, trigger)
+		}
+	}
+
 	return nil
 }
+
+var tables = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+        user_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        email TEXT UNIQUE,
+        full_name TEXT NOT NULL,
+        password_hash TEXT,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        is_guest BOOLEAN NOT NULL DEFAULT 0,
+        CHECK (is_guest = 1 OR (email IS NOT NULL AND password_hash IS NOT NULL))
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS groups (
+        group_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT NOT NULL,
+        description TEXT,
+        created_by INTEGER NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        archived_at DATETIME,
+        default_currency TEXT NOT NULL DEFAULT 'USD',
+        default_split_type TEXT CHECK (default_split_type IN ('EQUAL', 'EXACT', 'PERCENTAGE', 'SHARES', 'ADJUSTMENT', 'ITEMIZED')),
+        members_can_edit_others BOOLEAN NOT NULL DEFAULT 0,
+        FOREIGN KEY (created_by) REFERENCES users(user_id)
+    );`,
+
+	// Members who take part in a group's expenses when none are given
+	`CREATE TABLE IF NOT EXISTS group_default_participants (
+        group_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        PRIMARY KEY (group_id, user_id),
+        FOREIGN KEY (group_id) REFERENCES groups(group_id),
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS group_members (
+        group_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member', 'viewer')),
+        PRIMARY KEY (group_id, user_id),
+        FOREIGN KEY (group_id) REFERENCES groups(group_id),
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`,
+
+	// Money columns hold integer minor units (cents), see pkg/money
+	`CREATE TABLE IF NOT EXISTS expenses (
+        expense_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        group_id INTEGER NOT NULL,
+        description TEXT NOT NULL,
+        amount INTEGER NOT NULL,
+        created_by INTEGER NOT NULL,
+        split_type TEXT NOT NULL CHECK (split_type IN ('EQUAL', 'EXACT', 'PERCENTAGE', 'SHARES', 'ADJUSTMENT', 'ITEMIZED')),
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        tax INTEGER NOT NULL DEFAULT 0,
+        tip INTEGER NOT NULL DEFAULT 0,
+        service_charge INTEGER NOT NULL DEFAULT 0,
+        deleted_at DATETIME,
+        currency TEXT NOT NULL DEFAULT 'USD',
+        exchange_rate REAL NOT NULL DEFAULT 1 CHECK (exchange_rate > 0),
+        base_amount INTEGER NOT NULL DEFAULT 0,
+        expense_date TEXT NOT NULL DEFAULT '',
+        FOREIGN KEY (group_id) REFERENCES groups(group_id),
+        FOREIGN KEY (created_by) REFERENCES users(user_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS expense_shares (
+        expense_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        share_amount INTEGER NOT NULL,
+        share_percentage DECIMAL(5,2),
+        paid_amount INTEGER DEFAULT 0,
+        share_units INTEGER NOT NULL DEFAULT 0,
+        adjustment INTEGER NOT NULL DEFAULT 0,
+        PRIMARY KEY (expense_id, user_id),
+        FOREIGN KEY (expense_id) REFERENCES expenses(expense_id),
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS expense_payers (
+        expense_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        amount INTEGER NOT NULL,
+        PRIMARY KEY (expense_id, user_id),
+        FOREIGN KEY (expense_id) REFERENCES expenses(expense_id),
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS expense_items (
+        item_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        expense_id INTEGER NOT NULL,
+        description TEXT NOT NULL,
+        price INTEGER NOT NULL,
+        FOREIGN KEY (expense_id) REFERENCES expenses(expense_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS expense_item_participants (
+        item_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        PRIMARY KEY (item_id, user_id),
+        FOREIGN KEY (item_id) REFERENCES expense_items(item_id),
+        FOREIGN KEY (user_id) REFERENCES users(user_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS settlements (
+        settlement_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        payer_id INTEGER NOT NULL,
+        payee_id INTEGER NOT NULL,
+        amount INTEGER NOT NULL,
+        group_id INTEGER NOT NULL,
+        settled_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        notes TEXT,
+        write_off BOOLEAN NOT NULL DEFAULT 0,
+        FOREIGN KEY (payer_id) REFERENCES users(user_id),
+        FOREIGN KEY (payee_id) REFERENCES users(user_id),
+        FOREIGN KEY (group_id) REFERENCES groups(group_id)
+    );`,
+
+	// Revisions have no foreign key to expenses so the history of an expense
+	// outlives its purge from the trash
+	`CREATE TABLE IF NOT EXISTS expense_revisions (
+        revision_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        expense_id INTEGER NOT NULL,
+        action TEXT NOT NULL CHECK (action IN ('CREATE', 'UPDATE', 'DELETE', 'RESTORE')),
+        changed_by INTEGER NOT NULL,
+        changed_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        snapshot TEXT NOT NULL,
+        FOREIGN KEY (changed_by) REFERENCES users(user_id)
+    );`,
+
+	`CREATE TABLE IF NOT EXISTS group_invitations (
+        invitation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        group_id INTEGER NOT NULL,
+        email TEXT NOT NULL,
+        role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member', 'viewer')),
+        token TEXT UNIQUE NOT NULL,
+        invited_by INTEGER NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        expires_at DATETIME NOT NULL,
+        accepted_at DATETIME,
+        accepted_by INTEGER,
+        revoked_at DATETIME,
+        FOREIGN KEY (group_id) REFERENCES groups(group_id),
+        FOREIGN KEY (invited_by) REFERENCES users(user_id),
+        FOREIGN KEY (accepted_by) REFERENCES users(user_id)
+    );`,
+	`CREATE TABLE IF NOT EXISTS group_join_links (
+        link_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        group_id INTEGER NOT NULL,
+        token TEXT UNIQUE NOT NULL,
+        role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'member', 'viewer')),
+        requires_approval BOOLEAN NOT NULL DEFAULT 0,
+        max_uses INTEGER CHECK (max_uses > 0),
+        uses INTEGER NOT NULL DEFAULT 0,
+        created_by INTEGER NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        expires_at DATETIME,
+        revoked_at DATETIME,
+        FOREIGN KEY (group_id) REFERENCES groups(group_id),
+        FOREIGN KEY (created_by) REFERENCES users(user_id)
+    );`,
+	`CREATE TABLE IF NOT EXISTS group_join_requests (
+        request_id INTEGER PRIMARY KEY AUTOINCREMENT,
+        group_id INTEGER NOT NULL,
+        link_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        role TEXT NOT NULL CHECK (role IN ('admin', 'member', 'viewer')),
+        status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        decided_at DATETIME,
+        decided_by INTEGER,
+        FOREIGN KEY (group_id) REFERENCES groups(group_id),
+        FOREIGN KEY (link_id) REFERENCES group_join_links(link_id),
+        FOREIGN KEY (user_id) REFERENCES users(user_id),
+        FOREIGN KEY (decided_by) REFERENCES users(user_id)
+    );`,
+
+	// One unit of base_currency bought rate units of quote_currency that day
+	`CREATE TABLE IF NOT EXISTS exchange_rates (
+        base_currency TEXT NOT NULL,
+        quote_currency TEXT NOT NULL,
+        rate_date DATE NOT NULL,
+        rate REAL NOT NULL CHECK (rate > 0),
+        imported_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY (base_currency, quote_currency, rate_date)
+    );`,
+}
+
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS idx_expense_shares_expense_id ON expense_shares(expense_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_expense_shares_user_id ON expense_shares(user_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_expenses_group_id ON expenses(group_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses(deleted_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_expense_payers_user_id ON expense_payers(user_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_expense_items_expense_id ON expense_items(expense_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_settlements_payer_payee ON settlements(payer_id, payee_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_expense_revisions_expense_id ON expense_revisions(expense_id);`,
+	`CREATE INDEX IF NOT EXISTS idx_group_invitations_email ON group_invitations(email);`,
+	`CREATE INDEX IF NOT EXISTS idx_group_join_requests_group_id ON group_join_requests(group_id, status);`,
+	`CREATE INDEX IF NOT EXISTS idx_exchange_rates_quote ON exchange_rates(quote_currency, rate_date);`,
+}
+
+// triggers keep the expense history immutable.
+var triggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS expense_revisions_no_update
+    BEFORE UPDATE ON expense_revisions
+    BEGIN
+        SELECT RAISE(ABORT, 'expense revisions are immutable');
+    END;`,
+	`CREATE TRIGGER IF NOT EXISTS expense_revisions_no_delete
+    BEFORE DELETE ON expense_revisions
+    BEGIN
+        SELECT RAISE(ABORT, 'expense revisions are immutable');
+    END;`,
+}
@@ -0,0 +1,232 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrations upgrade databases created by an earlier version of the schema.
+// They run once each, in order, and PRAGMA user_version records how many of
+// them have been applied. New migrations must only ever be appended.
+var migrations = []func(tx *sqlx.Tx) error{
+	// Store money as integer minor units instead of DECIMAL values
+	func(tx *sqlx.Tx) error {
+		return execAll(tx,
+			`UPDATE expenses SET amount = CAST(ROUND(amount * 100) AS INTEGER)`,
+			`UPDATE expense_shares
+             SET share_amount = CAST(ROUND(share_amount * 100) AS INTEGER),
+                 paid_amount = CAST(ROUND(COALESCE(paid_amount, 0) * 100) AS INTEGER)`,
+			`UPDATE settlements SET amount = CAST(ROUND(amount * 100) AS INTEGER)`,
+		)
+	},
+
+	// Allow the SHARES split type and store each participant's units
+	func(tx *sqlx.Tx) error {
+		if err := rebuildTable(tx, "expenses"); err != nil {
+			return err
+		}
+		return addColumn(tx, "expense_shares", "share_units", "INTEGER NOT NULL DEFAULT 0")
+	},
+
+	// Allow the ADJUSTMENT split type and store each participant's adjustment
+	func(tx *sqlx.Tx) error {
+		if err := rebuildTable(tx, "expenses"); err != nil {
+			return err
+		}
+		return addColumn(tx, "expense_shares", "adjustment", "INTEGER NOT NULL DEFAULT 0")
+	},
+
+	// Allow the ITEMIZED split type and store receipt extras, the item
+	// tables themselves are created by InitSchema
+	func(tx *sqlx.Tx) error {
+		if err := rebuildTable(tx, "expenses"); err != nil {
+			return err
+		}
+		for _, column := range []string{"tax", "tip", "service_charge"} {
+			if err := addColumn(tx, "expenses", column, "INTEGER NOT NULL DEFAULT 0"); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+
+	// Move payments into expense_payers. Whatever paid_amount did not cover
+	// used to be treated as paid by the creator, so record that explicitly.
+	func(tx *sqlx.Tx) error {
+		return execAll(tx,
+			`INSERT INTO expense_payers (expense_id, user_id, amount)
+             SELECT expense_id, user_id, paid_amount
+             FROM expense_shares
+             WHERE paid_amount > 0`,
+			`INSERT INTO expense_payers (expense_id, user_id, amount)
+             SELECT e.expense_id, e.created_by,
+                 e.amount - COALESCE((SELECT SUM(paid_amount) FROM expense_shares es WHERE es.expense_id = e.expense_id), 0)
+             FROM expenses e
+             WHERE e.amount > COALESCE((SELECT SUM(paid_amount) FROM expense_shares es WHERE es.expense_id = e.expense_id), 0)
+             ON CONFLICT (expense_id, user_id) DO UPDATE SET amount = amount + excluded.amount`,
+		)
+	},
+
+	// Keep deleted expenses in a trash until they are purged
+	func(tx *sqlx.Tx) error {
+		return addColumn(tx, "expenses", "deleted_at", "DATETIME")
+	},
+
+	// Mark balances written off when a member is removed from a group
+	func(tx *sqlx.Tx) error {
+		return addColumn(tx, "settlements", "write_off", "BOOLEAN NOT NULL DEFAULT 0")
+	},
+
+	// Give every member a role, the creator of a group becomes its owner
+	func(tx *sqlx.Tx) error {
+		if err := rebuildTable(tx, "group_members"); err != nil {
+			return err
+		}
+		return execAll(tx,
+			`UPDATE group_members SET role = 'owner'
+             WHERE user_id = (SELECT created_by FROM groups g WHERE g.group_id = group_members.group_id)`,
+		)
+	},
+
+	// Allow guest users without an email address or password
+	func(tx *sqlx.Tx) error {
+		return rebuildTable(tx, "users")
+	},
+
+	// Let finished groups be archived
+	func(tx *sqlx.Tx) error {
+		return addColumn(tx, "groups", "archived_at", "DATETIME")
+	},
+
+	// Add group settings, the default participants table itself is created
+	// by InitSchema
+	func(tx *sqlx.Tx) error {
+		return rebuildTable(tx, "groups")
+	},
+
+	// Record the currency of each expense and its amount in the group's
+	// currency. Existing expenses are in the group's currency already.
+	func(tx *sqlx.Tx) error {
+		if err := rebuildTable(tx, "expenses"); err != nil {
+			return err
+		}
+		return execAll(tx,
+			`UPDATE expenses SET base_amount = amount,
+                 currency = (SELECT default_currency FROM groups g WHERE g.group_id = expenses.group_id)`,
+		)
+	},
+
+	// Record the day each expense was paid, which its exchange rate is
+	// looked up for. Existing expenses were paid the day they were recorded.
+	func(tx *sqlx.Tx) error {
+		if err := addColumn(tx, "expenses", "expense_date", "TEXT NOT NULL DEFAULT ''"); err != nil {
+			return err
+		}
+		return execAll(tx, `UPDATE expenses SET expense_date = date(created_at) WHERE expense_date = ''`)
+	},
+}
+
+func migrate(db *sqlx.DB) error {
+	var version int
+	if err := db.Get(&version, "PRAGMA user_version"); err != nil {
+		return fmt.Errorf("error reading schema version: %v", err)
+	}
+	if version >= len(migrations) {
+		return nil
+	}
+
+	// Rebuilding a table drops it, which foreign keys would refuse. The
+	// pragma is a no-op inside a transaction so it is switched off around
+	// the whole run instead.
+	if _, err := db.Exec("PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("error disabling foreign keys: %v", err)
+	}
+	defer db.Exec("PRAGMA foreign_keys = ON")
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		if err := migrations[i](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error applying migration %d: %v", i+1, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("error setting schema version: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func execAll(tx *sqlx.Tx, statements ...string) error {
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement); err != nil {
+			return fmt.Errorf("%v\nQuery: %s", err, statement)
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column unless it already exists. Tables rebuilt by an
+// earlier migration are created from the latest definition and may have it.
+func addColumn(tx *sqlx.Tx, table, column, definition string) error {
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	for _, existing := range columns {
+		if existing == column {
+			return nil
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// rebuildTable recreates a table from its latest definition in tables and
+// copies the existing rows across. SQLite cannot change constraints in
+// place, so this is how CHECK constraints are updated.
+func rebuildTable(tx *sqlx.Tx, table string) error {
+	prefix := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (", table)
+	var create string
+	for _, schema := range tables {
+		if strings.HasPrefix(schema, prefix) {
+			create = schema
+			break
+		}
+	}
+	if create == "" {
+		return fmt.Errorf("no schema for table %s", table)
+	}
+
+	columns, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	list := strings.Join(columns, ", ")
+	rebuilt := table + "_rebuilt"
+
+	return execAll(tx,
+		strings.Replace(create, prefix, fmt.Sprintf("CREATE TABLE %s (", rebuilt), 1),
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", rebuilt, list, list, table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, table),
+	)
+}
+
+func tableColumns(tx *sqlx.Tx, table string) ([]string, error) {
+	var columns []string
+	err := tx.Select(&columns, "SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// TrashConfig controls how long deleted expenses can still be restored.
+type TrashConfig struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// NewTrashConfig keeps deleted expenses for 30 days unless the
+// TRASH_RETENTION_DAYS environment variable says otherwise.
+func NewTrashConfig() *TrashConfig {
+	days := 30
+	if value, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && value > 0 {
+		days = value
+	}
+
+	return &TrashConfig{
+		Retention:     time.Duration(days) * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+	}
+}
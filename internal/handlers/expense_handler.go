@@ -5,9 +5,15 @@ import (
 	"expense-sharing-api/internal/middleware"
 	"expense-sharing-api/internal/models"
 	"expense-sharing-api/internal/repository"
+	"expense-sharing-api/pkg/money"
 	"expense-sharing-api/pkg/response"
+	"expense-sharing-api/pkg/settle"
+	"io"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -15,15 +21,21 @@ import (
 type ExpenseHandler struct {
 	expenseRepo *repository.ExpenseRepository
 	groupRepo   *repository.GroupRepository
+	userRepo    *repository.UserRepository
+	rateRepo    *repository.ExchangeRateRepository
 }
 
-func NewExpenseHandler(expenseRepo *repository.ExpenseRepository, groupRepo *repository.GroupRepository) *ExpenseHandler {
+func NewExpenseHandler(expenseRepo *repository.ExpenseRepository, groupRepo *repository.GroupRepository, userRepo *repository.UserRepository, rateRepo *repository.ExchangeRateRepository) *ExpenseHandler {
 	return &ExpenseHandler{
 		expenseRepo: expenseRepo,
 		groupRepo:   groupRepo,
+		userRepo:    userRepo,
+		rateRepo:    rateRepo,
 	}
 }
 
+// Create adds an expense to a group. A split type or participants left out
+// of the request are taken from the group's defaults.
 func (h *ExpenseHandler) Create(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(int)
 
@@ -33,28 +45,42 @@ func (h *ExpenseHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := input.Validate(); err != nil {
-		response.Error(w, http.StatusBadRequest, err.Error())
+	// The group's defaults are only applied once the caller is known to be
+	// a member, so that nothing about other groups leaks into the response
+	if input.GroupID == 0 {
+		response.Error(w, http.StatusBadRequest, "group ID is required")
+		return
+	}
+	role, ok := middleware.RequireGroupMember(w, h.groupRepo, input.GroupID, userID)
+	if !ok || !middleware.Authorize(w, role, models.PermWrite) {
+		return
+	}
+	if !middleware.RequireActiveGroup(w, h.groupRepo, input.GroupID) {
 		return
 	}
 
-	// Verify user is member of the group
 	group, err := h.groupRepo.GetByID(input.GroupID)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "group not found")
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
 		return
 	}
+	input.ApplyDefaults(group)
 
-	isMember := false
-	for _, member := range group.Members {
-		if member.UserID == userID {
-			isMember = true
-			break
-		}
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
 	}
-
-	if !isMember {
-		response.Error(w, http.StatusForbidden, "user is not a member of this group")
+	if input.ExpenseDate == "" {
+		input.ExpenseDate = time.Now().UTC().Format(models.DateLayout)
+	}
+	if !h.fillExchangeRate(w, &input, group.DefaultCurrency) {
+		return
+	}
+	if err := input.ValidateCurrency(group.DefaultCurrency); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.validateMembers(w, &input) {
 		return
 	}
 
@@ -67,13 +93,27 @@ func (h *ExpenseHandler) Create(w http.ResponseWriter, r *http.Request) {
 	response.JSON(w, http.StatusCreated, expense)
 }
 
-func (h *ExpenseHandler) GetGroupExpenses(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	groupID, err := strconv.Atoi(params["id"])
+// GetByID returns a single expense with its shares, payers and the profile
+// of the member who created it. Expenses in the trash can be read as well.
+func (h *ExpenseHandler) GetByID(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	expense, _, ok := h.expenseForRead(w, r, userID)
+	if !ok {
+		return
+	}
+
+	creator, err := h.userRepo.GetByID(expense.CreatedBy)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "invalid group ID")
+		response.Error(w, http.StatusInternalServerError, "error fetching expense creator")
 		return
 	}
+	expense.Creator = creator
+
+	response.JSON(w, http.StatusOK, expense)
+}
+
+func (h *ExpenseHandler) GetGroupExpenses(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
 
 	expenses, err := h.expenseRepo.GetGroupExpenses(groupID)
 	if err != nil {
@@ -86,12 +126,7 @@ func (h *ExpenseHandler) GetGroupExpenses(w http.ResponseWriter, r *http.Request
 
 func (h *ExpenseHandler) GetBalanceSheet(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(int)
-	params := mux.Vars(r)
-	groupID, err := strconv.Atoi(params["id"])
-	if err != nil {
-		response.Error(w, http.StatusBadRequest, "invalid group ID")
-		return
-	}
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
 
 	balances, err := h.expenseRepo.GetUserBalance(userID, groupID)
 	if err != nil {
@@ -101,3 +136,311 @@ func (h *ExpenseHandler) GetBalanceSheet(w http.ResponseWriter, r *http.Request)
 
 	response.JSON(w, http.StatusOK, balances)
 }
+
+func (h *ExpenseHandler) GetSettlePlan(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	balances, err := h.expenseRepo.GetNetBalances(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching balances")
+		return
+	}
+
+	net := make(map[int]money.Money, len(balances))
+	for _, b := range balances {
+		net[b.UserID] = b.Amount
+	}
+
+	response.JSON(w, http.StatusOK, models.SettlePlan{
+		GroupID:   groupID,
+		Currency:  group.DefaultCurrency,
+		Balances:  balances,
+		Transfers: settle.Simplify(net),
+	})
+}
+
+// Update replaces an expense with the request body, which has the same shape
+// as for Create.
+func (h *ExpenseHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	existing, ok := h.expenseForChange(w, r, userID, false)
+	if !ok {
+		return
+	}
+
+	var input models.ExpenseCreate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	h.saveChanges(w, existing, &input, userID)
+}
+
+// Patch applies the fields present in the request body on top of the stored
+// expense. Lists such as shares, payers and items are replaced as a whole.
+func (h *ExpenseHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	existing, ok := h.expenseForChange(w, r, userID, false)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	input, err := existing.ApplyPatch(body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	h.saveChanges(w, existing, &input, userID)
+}
+
+func (h *ExpenseHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	existing, ok := h.expenseForChange(w, r, userID, false)
+	if !ok {
+		return
+	}
+
+	if err := h.expenseRepo.Delete(existing.ExpenseID, userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error deleting expense")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"expense_id": existing.ExpenseID,
+		"deleted":    true,
+	})
+}
+
+func (h *ExpenseHandler) saveChanges(w http.ResponseWriter, existing *models.Expense, input *models.ExpenseCreate, userID int) {
+	if input.GroupID == 0 {
+		input.GroupID = existing.GroupID
+	}
+	if input.GroupID != existing.GroupID {
+		response.Error(w, http.StatusBadRequest, "expenses cannot be moved to another group")
+		return
+	}
+
+	if input.ExpenseDate == "" {
+		input.ExpenseDate = existing.ExpenseDate
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(input.GroupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+	if !h.fillExchangeRate(w, input, group.DefaultCurrency) {
+		return
+	}
+	if err := input.ValidateCurrency(group.DefaultCurrency); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !h.validateMembers(w, input) {
+		return
+	}
+
+	expense, err := h.expenseRepo.Update(existing.ExpenseID, input, existing.CreatedBy, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error updating expense")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, expense)
+}
+
+// Restore moves an expense out of the trash.
+func (h *ExpenseHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	existing, ok := h.expenseForChange(w, r, userID, true)
+	if !ok {
+		return
+	}
+
+	// Bringing back an expense of someone who has left would put them back
+	// in the balances, so they have to rejoin first
+	memberIDs, err := h.groupRepo.GetMemberIDs(existing.GroupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group members")
+		return
+	}
+	restored := existing.ToCreate()
+	if errs := restored.ValidateMembers(memberIDs); len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		seen := make(map[string]bool, len(errs))
+		for _, message := range errs {
+			if !seen[message] {
+				seen[message] = true
+				messages = append(messages, message)
+			}
+		}
+		sort.Strings(messages)
+		response.Error(w, http.StatusConflict, "expense cannot be restored, "+strings.Join(messages, ", "))
+		return
+	}
+
+	expense, err := h.expenseRepo.Restore(existing.ExpenseID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error restoring expense")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, expense)
+}
+
+func (h *ExpenseHandler) GetGroupTrash(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+
+	expenses, err := h.expenseRepo.GetGroupTrash(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching trash")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, expenses)
+}
+
+// History lists every revision of an expense with the fields it changed.
+// Expenses in the trash keep their history.
+func (h *ExpenseHandler) History(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	expense, _, ok := h.expenseForRead(w, r, userID)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.expenseRepo.GetHistory(expense.ExpenseID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching expense history")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, revisions)
+}
+
+// expenseForRead loads the expense named in the URL together with the
+// user's role in its group. Users outside the group get a 404 so expense IDs
+// of other groups are not revealed.
+func (h *ExpenseHandler) expenseForRead(w http.ResponseWriter, r *http.Request, userID int) (*models.Expense, models.Role, bool) {
+	params := mux.Vars(r)
+	expenseID, err := strconv.Atoi(params["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid expense ID")
+		return nil, "", false
+	}
+
+	expense, err := h.expenseRepo.GetByID(expenseID)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "expense not found")
+		return nil, "", false
+	}
+
+	role, err := h.groupRepo.GetRole(expense.GroupID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return nil, "", false
+	}
+	if role == "" {
+		response.Error(w, http.StatusNotFound, "expense not found")
+		return nil, "", false
+	}
+
+	return expense, role, true
+}
+
+// expenseForChange loads the expense named in the URL like expenseForRead
+// and checks that the user may change it: members may change their own
+// expenses, and admins and the owner those of others as well, as can all
+// members if the group allows it. The group must not be archived. With
+// deleted set the expense must be in the trash, otherwise it must not be.
+func (h *ExpenseHandler) expenseForChange(w http.ResponseWriter, r *http.Request, userID int, deleted bool) (*models.Expense, bool) {
+	expense, role, ok := h.expenseForRead(w, r, userID)
+	if !ok {
+		return nil, false
+	}
+	if deleted != (expense.DeletedAt != nil) {
+		if deleted {
+			response.Error(w, http.StatusBadRequest, "expense is not in the trash")
+		} else {
+			response.Error(w, http.StatusNotFound, "expense not found")
+		}
+		return nil, false
+	}
+
+	if !middleware.Authorize(w, role, models.PermWrite) {
+		return nil, false
+	}
+	if userID != expense.CreatedBy && !role.Can(models.PermEditOthersExpenses) {
+		allowed, err := h.groupRepo.MembersCanEditOthers(expense.GroupID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "error fetching group settings")
+			return nil, false
+		}
+		if !allowed {
+			response.Error(w, http.StatusForbidden, "only the creator or a group admin can change this expense")
+			return nil, false
+		}
+	}
+	if !middleware.RequireActiveGroup(w, h.groupRepo, expense.GroupID) {
+		return nil, false
+	}
+
+	return expense, true
+}
+
+// fillExchangeRate looks up the rate to the group's currency on the day of
+// the expense for foreign currency expenses that leave it out. Without a
+// stored rate the input is left alone, so validation asks the client for one.
+// It must be called after Validate.
+func (h *ExpenseHandler) fillExchangeRate(w http.ResponseWriter, input *models.ExpenseCreate, baseCurrency string) bool {
+	currency := strings.ToUpper(input.Currency)
+	if input.ExchangeRate != 0 || currency == "" || currency == baseCurrency {
+		return true
+	}
+
+	on, _ := time.Parse(models.DateLayout, input.ExpenseDate)
+	rate, err := h.rateRepo.Lookup(currency, baseCurrency, on)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error looking up exchange rate")
+		return false
+	}
+	if rate != nil {
+		input.ExchangeRate = rate.Value
+	}
+	return true
+}
+
+// validateMembers rejects expenses that name users outside the group, or the
+// same user twice, with an error for each offending field.
+func (h *ExpenseHandler) validateMembers(w http.ResponseWriter, input *models.ExpenseCreate) bool {
+	memberIDs, err := h.groupRepo.GetMemberIDs(input.GroupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group members")
+		return false
+	}
+
+	if errs := input.ValidateMembers(memberIDs); len(errs) > 0 {
+		response.ValidationError(w, errs)
+		return false
+	}
+	return true
+}
@@ -5,7 +5,10 @@ import (
 	"expense-sharing-api/internal/middleware"
 	"expense-sharing-api/internal/models"
 	"expense-sharing-api/internal/repository"
+	"expense-sharing-api/pkg/money"
 	"expense-sharing-api/pkg/response"
+	"expense-sharing-api/pkg/settle"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -13,11 +16,17 @@ import (
 )
 
 type GroupHandler struct {
-	groupRepo *repository.GroupRepository
+	groupRepo   *repository.GroupRepository
+	userRepo    *repository.UserRepository
+	expenseRepo *repository.ExpenseRepository
 }
 
-func NewGroupHandler(groupRepo *repository.GroupRepository) *GroupHandler {
-	return &GroupHandler{groupRepo: groupRepo}
+func NewGroupHandler(groupRepo *repository.GroupRepository, userRepo *repository.UserRepository, expenseRepo *repository.ExpenseRepository) *GroupHandler {
+	return &GroupHandler{
+		groupRepo:   groupRepo,
+		userRepo:    userRepo,
+		expenseRepo: expenseRepo,
+	}
 }
 
 func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -34,6 +43,29 @@ func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// As in AddMember, guests of other groups are treated as unknown users
+	errs := make(map[string]string)
+	seen := make(map[int]bool, len(input.Members))
+	for i, memberID := range input.Members {
+		field := fmt.Sprintf("members[%d]", i)
+		if seen[memberID] {
+			errs[field] = fmt.Sprintf("user %d is listed more than once", memberID)
+			continue
+		}
+		seen[memberID] = true
+		if memberID == userID {
+			continue
+		}
+		user, err := h.userRepo.GetByID(memberID)
+		if err != nil || user.IsGuest {
+			errs[field] = fmt.Sprintf("user %d not found", memberID)
+		}
+	}
+	if len(errs) > 0 {
+		response.ValidationError(w, errs)
+		return
+	}
+
 	group, err := h.groupRepo.Create(&input, userID)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "error creating group")
@@ -43,10 +75,21 @@ func (h *GroupHandler) Create(w http.ResponseWriter, r *http.Request) {
 	response.JSON(w, http.StatusCreated, group)
 }
 
+// GetUserGroups lists the caller's groups. Archived groups are left out
+// unless asked for with status=archived or status=all.
 func (h *GroupHandler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
 	userID := r.Context().Value(middleware.UserIDKey).(int)
 
-	groups, err := h.groupRepo.GetUserGroups(userID)
+	filter := models.GroupFilter(r.URL.Query().Get("status"))
+	if filter == "" {
+		filter = models.GroupsActive
+	}
+	if !filter.Valid() {
+		response.Error(w, http.StatusBadRequest, "status must be active, archived or all")
+		return
+	}
+
+	groups, err := h.groupRepo.GetUserGroups(userID, filter)
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "error fetching groups")
 		return
@@ -56,18 +99,551 @@ func (h *GroupHandler) GetUserGroups(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *GroupHandler) GetByID(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	groupID, err := strconv.Atoi(params["id"])
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "group not found")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+// Update renames the group, changes its description or its settings.
+func (h *GroupHandler) Update(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermEditGroup) {
+		return
+	}
+
+	var input models.GroupUpdate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	memberIDs, err := h.groupRepo.GetMemberIDs(groupID)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, "invalid group ID")
+		response.Error(w, http.StatusInternalServerError, "error fetching group members")
+		return
+	}
+	if errs := input.ValidateMembers(memberIDs); len(errs) > 0 {
+		response.ValidationError(w, errs)
+		return
+	}
+
+	// Exchange rates and settlements are relative to the group's currency
+	if input.DefaultCurrency != nil {
+		group, err := h.groupRepo.GetByID(groupID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "error fetching group")
+			return
+		}
+		if *input.DefaultCurrency != group.DefaultCurrency {
+			used, err := h.groupRepo.HasTransactions(groupID)
+			if err != nil {
+				response.Error(w, http.StatusInternalServerError, "error checking group expenses")
+				return
+			}
+			if used {
+				response.Error(w, http.StatusConflict, "the group's currency cannot be changed once it has expenses or settlements")
+				return
+			}
+		}
+	}
+
+	group, err := h.groupRepo.Update(groupID, &input)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error updating group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+// Archive makes the group read-only. Groups whose balances are not settled
+// can only be archived with force=true.
+func (h *GroupHandler) Archive(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermEditGroup) {
+		return
+	}
+
+	archived, err := h.groupRepo.IsArchived(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group status")
+		return
+	}
+	if archived {
+		response.Error(w, http.StatusBadRequest, "group is already archived")
+		return
+	}
+
+	if r.URL.Query().Get("force") != "true" {
+		balances, err := h.expenseRepo.GetNetBalances(groupID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "error fetching balances")
+			return
+		}
+		for _, b := range balances {
+			if b.Amount != 0 {
+				response.Error(w, http.StatusConflict, "group has outstanding balances, settle up first or archive with force=true")
+				return
+			}
+		}
+	}
+
+	if err := h.groupRepo.Archive(groupID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error archiving group")
 		return
 	}
 
 	group, err := h.groupRepo.GetByID(groupID)
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "group not found")
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+func (h *GroupHandler) Unarchive(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermEditGroup) {
+		return
+	}
+
+	archived, err := h.groupRepo.IsArchived(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group status")
+		return
+	}
+	if !archived {
+		response.Error(w, http.StatusBadRequest, "group is not archived")
+		return
+	}
+
+	if err := h.groupRepo.Unarchive(groupID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error unarchiving group")
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
 		return
 	}
 
 	response.JSON(w, http.StatusOK, group)
 }
+
+// AddMember adds an existing user to the group with a role below the
+// caller's own.
+func (h *GroupHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	var input models.MemberAdd
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !role.Outranks(input.Role) {
+		response.Error(w, http.StatusForbidden, "you can only add members with a role below your own")
+		return
+	}
+
+	// Guests belong to the group that created them and cannot be added to
+	// other groups, so they are treated as unknown here
+	user, err := h.userRepo.GetByID(input.UserID)
+	if err != nil || user.IsGuest {
+		response.Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+
+	isMember, err := h.groupRepo.IsMember(groupID, input.UserID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return
+	}
+	if isMember {
+		response.Error(w, http.StatusConflict, "user is already a member of this group")
+		return
+	}
+
+	if err := h.groupRepo.AddMember(groupID, input.UserID, input.Role); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error adding member")
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, group)
+}
+
+// SetRole changes the role of another member. Both their current and their
+// new role must be below the caller's.
+func (h *GroupHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	memberID, memberRole, ok := h.memberFromPath(w, r, groupID)
+	if !ok {
+		return
+	}
+
+	var input models.RoleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !role.Outranks(memberRole) || !role.Outranks(input.Role) {
+		response.Error(w, http.StatusForbidden, "you can only manage members with a role below your own")
+		return
+	}
+
+	member, err := h.userRepo.GetByID(memberID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching user")
+		return
+	}
+	if member.IsGuest {
+		response.Error(w, http.StatusBadRequest, "guests can only be members")
+		return
+	}
+
+	if err := h.groupRepo.SetRole(groupID, memberID, input.Role); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error changing role")
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+// TransferOwnership hands the group over to another member. The previous
+// owner becomes an admin.
+func (h *GroupHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermTransferOwnership) {
+		return
+	}
+
+	var input models.OwnershipTransfer
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if input.UserID == userID {
+		response.Error(w, http.StatusBadRequest, "you already own this group")
+		return
+	}
+
+	isMember, err := h.groupRepo.IsMember(groupID, input.UserID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return
+	}
+	if !isMember {
+		response.Error(w, http.StatusBadRequest, "ownership can only be transferred to a member of the group")
+		return
+	}
+
+	newOwner, err := h.userRepo.GetByID(input.UserID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching user")
+		return
+	}
+	if newOwner.IsGuest {
+		response.Error(w, http.StatusBadRequest, "ownership cannot be transferred to a guest")
+		return
+	}
+
+	if err := h.groupRepo.TransferOwnership(groupID, userID, input.UserID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error transferring ownership")
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+// RemoveMember takes another member out of the group. Only members who
+// outrank them may do so, and with force=true the member's outstanding
+// balance is written off instead of blocking the removal.
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	memberID, memberRole, ok := h.memberFromPath(w, r, groupID)
+	if !ok {
+		return
+	}
+	if !role.Outranks(memberRole) {
+		response.Error(w, http.StatusForbidden, "you can only manage members with a role below your own")
+		return
+	}
+
+	h.removeMember(w, groupID, memberID, r.URL.Query().Get("force") == "true")
+}
+
+// Leave takes the caller out of the group once they are settled up. The
+// owner has to transfer ownership first.
+func (h *GroupHandler) Leave(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+
+	if role == models.RoleOwner {
+		response.Error(w, http.StatusBadRequest, "the owner cannot leave the group, transfer ownership first")
+		return
+	}
+
+	h.removeMember(w, groupID, userID, false)
+}
+
+// AddGuest adds a named placeholder for someone without an account. Guests
+// can take part in and pay for expenses like any other member.
+func (h *GroupHandler) AddGuest(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	var input models.GuestCreate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	guest, err := h.groupRepo.AddGuest(groupID, input.FullName)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error adding guest")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, guest)
+}
+
+// MergeGuest hands a guest's shares, payments and settlements over to a
+// registered member of the group, typically once the guest has signed up.
+func (h *GroupHandler) MergeGuest(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	guestID, err := strconv.Atoi(mux.Vars(r)["guestId"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid guest ID")
+		return
+	}
+
+	var input models.GuestMerge
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	isMember, err := h.groupRepo.IsMember(groupID, guestID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return
+	}
+	guest, err := h.userRepo.GetByID(guestID)
+	if !isMember || err != nil || !guest.IsGuest {
+		response.Error(w, http.StatusNotFound, "guest not found")
+		return
+	}
+
+	// Only members can take over a guest, so nobody outside the group can
+	// have balances moved onto their account
+	isMember, err = h.groupRepo.IsMember(groupID, input.UserID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return
+	}
+	user, err := h.userRepo.GetByID(input.UserID)
+	if !isMember || err != nil {
+		response.Error(w, http.StatusBadRequest, "guests can only be merged into a member of the group")
+		return
+	}
+	if user.IsGuest {
+		response.Error(w, http.StatusBadRequest, "guests can only be merged into a registered user")
+		return
+	}
+
+	// The merge only touches this group, so a guest that was also added to
+	// other groups before that was disallowed cannot be merged from here
+	elsewhere, err := h.groupRepo.GuestElsewhere(guestID, groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking guest groups")
+		return
+	}
+	if elsewhere {
+		response.Error(w, http.StatusConflict, "guest also belongs to another group and cannot be merged from here")
+		return
+	}
+
+	shared, err := h.groupRepo.SharedExpenses(guestID, input.UserID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking expenses")
+		return
+	}
+	if len(shared) > 0 {
+		response.Error(w, http.StatusConflict, fmt.Sprintf(
+			"guest and user both take part in expenses %v, edit them so only one of them does first", shared))
+		return
+	}
+
+	if err := h.groupRepo.MergeGuest(groupID, guestID, input.UserID, userID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error merging guest")
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+// memberFromPath reads the member named by {userId} and their role.
+func (h *GroupHandler) memberFromPath(w http.ResponseWriter, r *http.Request, groupID int) (int, models.Role, bool) {
+	memberID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid user ID")
+		return 0, "", false
+	}
+
+	role, err := h.groupRepo.GetRole(groupID, memberID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return 0, "", false
+	}
+	if role == "" {
+		response.Error(w, http.StatusNotFound, "user is not a member of this group")
+		return 0, "", false
+	}
+
+	return memberID, role, true
+}
+
+// removeMember refuses to remove a member with a non-zero balance unless
+// forced. A forced removal records the member's transfers in the settle-up
+// plan as write-offs. That brings the member to zero at the expense of the
+// counterparties settle.Simplify paired them with: creditors they owed lose
+// that credit, and members who owed them are let off.
+func (h *GroupHandler) removeMember(w http.ResponseWriter, groupID, memberID int, force bool) {
+	balances, err := h.expenseRepo.GetNetBalances(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching balances")
+		return
+	}
+	net := make(map[int]money.Money, len(balances))
+	for _, b := range balances {
+		net[b.UserID] = b.Amount
+	}
+
+	writeOffs := []models.Settlement{}
+	if net[memberID] != 0 {
+		if !force {
+			response.Error(w, http.StatusConflict, fmt.Sprintf(
+				"member has an outstanding balance of %s and must settle up first", net[memberID]))
+			return
+		}
+		// Write-offs are settlements, which archived groups do not accept
+		if !middleware.RequireActiveGroup(w, h.groupRepo, groupID) {
+			return
+		}
+		for _, transfer := range settle.Simplify(net) {
+			if transfer.From != memberID && transfer.To != memberID {
+				continue
+			}
+			writeOffs = append(writeOffs, models.Settlement{
+				PayerID:  transfer.From,
+				PayeeID:  transfer.To,
+				Amount:   transfer.Amount,
+				GroupID:  groupID,
+				Notes:    fmt.Sprintf("Written off when user %d was removed from the group", memberID),
+				WriteOff: true,
+			})
+		}
+	}
+
+	if err := h.groupRepo.RemoveMember(groupID, memberID, writeOffs); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error removing member")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]interface{}{
+		"group_id":   groupID,
+		"user_id":    memberID,
+		"removed":    true,
+		"write_offs": writeOffs,
+	})
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-sharing-api/internal/middleware"
+	"expense-sharing-api/internal/models"
+	"expense-sharing-api/internal/repository"
+	"expense-sharing-api/pkg/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type InvitationHandler struct {
+	invitationRepo *repository.InvitationRepository
+	groupRepo      *repository.GroupRepository
+	userRepo       *repository.UserRepository
+}
+
+func NewInvitationHandler(invitationRepo *repository.InvitationRepository, groupRepo *repository.GroupRepository, userRepo *repository.UserRepository) *InvitationHandler {
+	return &InvitationHandler{
+		invitationRepo: invitationRepo,
+		groupRepo:      groupRepo,
+		userRepo:       userRepo,
+	}
+}
+
+// Create invites someone to the group by email. The API does not send the
+// email itself, the token in the response has to be passed on to them.
+func (h *InvitationHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	var input models.InvitationCreate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !role.Outranks(input.Role) {
+		response.Error(w, http.StatusForbidden, "you can only invite members with a role below your own")
+		return
+	}
+
+	// Registered users may already be in the group
+	if user, err := h.userRepo.GetByEmail(input.Email); err == nil {
+		isMember, err := h.groupRepo.IsMember(groupID, user.UserID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "error checking group membership")
+			return
+		}
+		if isMember {
+			response.Error(w, http.StatusConflict, "user is already a member of this group")
+			return
+		}
+	}
+
+	pending, err := h.invitationRepo.HasPending(groupID, input.Email)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking invitations")
+		return
+	}
+	if pending {
+		response.Error(w, http.StatusConflict, "an invitation for this email is already pending")
+		return
+	}
+
+	invitation, err := h.invitationRepo.Create(groupID, &input, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error creating invitation")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, invitation)
+}
+
+func (h *InvitationHandler) GetGroupInvitations(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	invitations, err := h.invitationRepo.GetGroupInvitations(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching invitations")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, invitations)
+}
+
+// Revoke withdraws a pending invitation so its token can no longer be used.
+func (h *InvitationHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	invitationID, err := strconv.Atoi(mux.Vars(r)["invitationId"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid invitation ID")
+		return
+	}
+
+	invitation, err := h.invitationRepo.GetByID(invitationID)
+	if err != nil || invitation.GroupID != groupID {
+		response.Error(w, http.StatusNotFound, "invitation not found")
+		return
+	}
+	if invitation.Status != models.InvitationPending {
+		response.Error(w, http.StatusBadRequest, "only pending invitations can be revoked")
+		return
+	}
+
+	if err := h.invitationRepo.Revoke(invitationID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error revoking invitation")
+		return
+	}
+
+	invitation, err = h.invitationRepo.GetByID(invitationID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching invitation")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, invitation)
+}
+
+// GetMine lists the pending invitations sent to the caller's email address.
+func (h *InvitationHandler) GetMine(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching user")
+		return
+	}
+
+	invitations, err := h.invitationRepo.GetPendingForEmail(*user.Email)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching invitations")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, invitations)
+}
+
+// Accept redeems an invitation sent to the caller's email address.
+func (h *InvitationHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var input models.InvitationAccept
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching user")
+		return
+	}
+
+	invitation, err := h.invitationRepo.GetByToken(input.Token)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "invitation not found")
+		return
+	}
+	if err := invitation.CheckRedeemable(*user.Email); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = h.invitationRepo.Accept(invitation, userID)
+	if errors.Is(err, repository.ErrInvitationNotPending) {
+		response.Error(w, http.StatusBadRequest, "invitation is no longer pending")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error accepting invitation")
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(invitation.GroupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
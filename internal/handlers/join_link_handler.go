@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"expense-sharing-api/internal/middleware"
+	"expense-sharing-api/internal/models"
+	"expense-sharing-api/internal/repository"
+	"expense-sharing-api/pkg/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type JoinLinkHandler struct {
+	joinLinkRepo *repository.JoinLinkRepository
+	groupRepo    *repository.GroupRepository
+}
+
+func NewJoinLinkHandler(joinLinkRepo *repository.JoinLinkRepository, groupRepo *repository.GroupRepository) *JoinLinkHandler {
+	return &JoinLinkHandler{
+		joinLinkRepo: joinLinkRepo,
+		groupRepo:    groupRepo,
+	}
+}
+
+// Create generates a shareable join link for the group.
+func (h *JoinLinkHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	var input models.JoinLinkCreate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !role.Outranks(input.Role) {
+		response.Error(w, http.StatusForbidden, "you can only hand out roles below your own")
+		return
+	}
+
+	link, err := h.joinLinkRepo.Create(groupID, &input, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error creating join link")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, link)
+}
+
+func (h *JoinLinkHandler) GetGroupLinks(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	links, err := h.joinLinkRepo.GetGroupLinks(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching join links")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, links)
+}
+
+// Revoke disables a join link. Requests already made through it stay open.
+func (h *JoinLinkHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	linkID, err := strconv.Atoi(mux.Vars(r)["linkId"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid join link ID")
+		return
+	}
+
+	link, err := h.joinLinkRepo.GetByID(linkID)
+	if err != nil || link.GroupID != groupID {
+		response.Error(w, http.StatusNotFound, "join link not found")
+		return
+	}
+	if link.Status == models.JoinLinkRevoked {
+		response.Error(w, http.StatusBadRequest, "join link has already been revoked")
+		return
+	}
+
+	if err := h.joinLinkRepo.Revoke(linkID); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error revoking join link")
+		return
+	}
+
+	link, err = h.joinLinkRepo.GetByID(linkID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching join link")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, link)
+}
+
+// Join redeems a join link for the caller. Depending on the link they either
+// become a member right away or have to wait for an admin to approve them.
+func (h *JoinLinkHandler) Join(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+
+	var input models.JoinLinkRedeem
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	link, err := h.joinLinkRepo.GetByToken(input.Token)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, "join link not found")
+		return
+	}
+	if err := link.CheckUsable(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	isMember, err := h.groupRepo.IsMember(link.GroupID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return
+	}
+	if isMember {
+		response.Error(w, http.StatusConflict, "you are already a member of this group")
+		return
+	}
+
+	pending, err := h.joinLinkRepo.HasPendingRequest(link.GroupID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking join requests")
+		return
+	}
+	if pending {
+		response.Error(w, http.StatusConflict, "your request to join this group is already pending")
+		return
+	}
+
+	request, err := h.joinLinkRepo.Redeem(link, userID)
+	if errors.Is(err, repository.ErrJoinLinkUnusable) {
+		response.Error(w, http.StatusConflict, "join link can no longer be used")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error joining group")
+		return
+	}
+	if request != nil {
+		response.JSON(w, http.StatusAccepted, request)
+		return
+	}
+
+	group, err := h.groupRepo.GetByID(link.GroupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching group")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, group)
+}
+
+func (h *JoinLinkHandler) GetPendingRequests(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	requests, err := h.joinLinkRepo.GetPendingRequests(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching join requests")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, requests)
+}
+
+func (h *JoinLinkHandler) Approve(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, true)
+}
+
+func (h *JoinLinkHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, false)
+}
+
+// decide approves or rejects the pending join request named in the path.
+func (h *JoinLinkHandler) decide(w http.ResponseWriter, r *http.Request, approve bool) {
+	userID := r.Context().Value(middleware.UserIDKey).(int)
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermManageMembers) {
+		return
+	}
+
+	requestID, err := strconv.Atoi(mux.Vars(r)["requestId"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid join request ID")
+		return
+	}
+
+	request, err := h.joinLinkRepo.GetRequest(requestID)
+	if err != nil || request.GroupID != groupID {
+		response.Error(w, http.StatusNotFound, "join request not found")
+		return
+	}
+	if request.Status != models.JoinRequestPending {
+		response.Error(w, http.StatusBadRequest, "join request has already been decided")
+		return
+	}
+	if approve && !role.Outranks(request.Role) {
+		response.Error(w, http.StatusForbidden, "you can only admit members with a role below your own")
+		return
+	}
+
+	err = h.joinLinkRepo.Decide(request, approve, userID)
+	if errors.Is(err, repository.ErrJoinRequestNotPending) {
+		response.Error(w, http.StatusConflict, "join request has already been decided")
+		return
+	}
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error deciding join request")
+		return
+	}
+
+	request, err = h.joinLinkRepo.GetRequest(requestID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching join request")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, request)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"expense-sharing-api/internal/middleware"
+	"expense-sharing-api/internal/models"
+	"expense-sharing-api/internal/repository"
+	"expense-sharing-api/pkg/response"
+	"net/http"
+)
+
+type SettlementHandler struct {
+	expenseRepo *repository.ExpenseRepository
+	groupRepo   *repository.GroupRepository
+}
+
+func NewSettlementHandler(expenseRepo *repository.ExpenseRepository, groupRepo *repository.GroupRepository) *SettlementHandler {
+	return &SettlementHandler{
+		expenseRepo: expenseRepo,
+		groupRepo:   groupRepo,
+	}
+}
+
+func (h *SettlementHandler) Create(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+	role := r.Context().Value(middleware.GroupRoleKey).(models.Role)
+	if !middleware.Authorize(w, role, models.PermWrite) {
+		return
+	}
+	if !middleware.RequireActiveGroup(w, h.groupRepo, groupID) {
+		return
+	}
+
+	var input models.SettlementCreate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		response.Error(w, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Both sides of the settlement must belong to the group
+	for _, participantID := range []int{input.PayerID, input.PayeeID} {
+		isMember, err := h.groupRepo.IsMember(groupID, participantID)
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "error checking group membership")
+			return
+		}
+		if !isMember {
+			response.Error(w, http.StatusBadRequest, "payer and payee must be members of the group")
+			return
+		}
+	}
+
+	settlement := models.Settlement{
+		PayerID: input.PayerID,
+		PayeeID: input.PayeeID,
+		Amount:  input.Amount,
+		GroupID: groupID,
+		Notes:   input.Notes,
+	}
+	if err := h.expenseRepo.Settle(&settlement); err != nil {
+		response.Error(w, http.StatusInternalServerError, "error recording settlement")
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, settlement)
+}
+
+func (h *SettlementHandler) GetGroupSettlements(w http.ResponseWriter, r *http.Request) {
+	groupID := r.Context().Value(middleware.GroupIDKey).(int)
+
+	settlements, err := h.expenseRepo.GetGroupSettlements(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error fetching settlements")
+		return
+	}
+
+	response.JSON(w, http.StatusOK, settlements)
+}
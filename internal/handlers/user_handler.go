@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"expense-sharing-api/internal/models"
 	"expense-sharing-api/internal/repository"
 	"expense-sharing-api/pkg/auth"
@@ -11,11 +12,15 @@ import (
 )
 
 type UserHandler struct {
-	userRepo *repository.UserRepository
+	userRepo       *repository.UserRepository
+	invitationRepo *repository.InvitationRepository
 }
 
-func NewUserHandler(userRepo *repository.UserRepository) *UserHandler {
-	return &UserHandler{userRepo: userRepo}
+func NewUserHandler(userRepo *repository.UserRepository, invitationRepo *repository.InvitationRepository) *UserHandler {
+	return &UserHandler{
+		userRepo:       userRepo,
+		invitationRepo: invitationRepo,
+	}
 }
 
 func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -30,6 +35,22 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check the invitation before the account exists, so a bad token is
+	// reported as such rather than as a failed registration
+	var invitation *models.Invitation
+	if input.InviteToken != "" {
+		var err error
+		invitation, err = h.invitationRepo.GetByToken(input.InviteToken)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "invitation not found")
+			return
+		}
+		if err := invitation.CheckRedeemable(input.Email); err != nil {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
 	// Hash password
 	passwordHash, err := hash.HashPassword(input.Password)
 	if err != nil {
@@ -37,8 +58,17 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create user
-	user, err := h.userRepo.Create(&input, passwordHash)
+	// Create user, joining the invited group in the same transaction
+	var user *models.User
+	if invitation != nil {
+		user, err = h.userRepo.CreateWithInvitation(&input, passwordHash, invitation)
+	} else {
+		user, err = h.userRepo.Create(&input, passwordHash)
+	}
+	if errors.Is(err, repository.ErrInvitationNotPending) {
+		response.Error(w, http.StatusBadRequest, "invitation is no longer pending")
+		return
+	}
 	if err != nil {
 		response.Error(w, http.StatusInternalServerError, "error creating user")
 		return
@@ -51,10 +81,14 @@ func (h *UserHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.JSON(w, http.StatusCreated, map[string]interface{}{
+	data := map[string]interface{}{
 		"user":  user,
 		"token": token,
-	})
+	}
+	if invitation != nil {
+		data["joined_group_id"] = invitation.GroupID
+	}
+	response.JSON(w, http.StatusCreated, data)
 }
 
 func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -70,7 +104,8 @@ func (h *UserHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !hash.CheckPassword(input.Password, user.PasswordHash) {
+	// Guests have no password and can never log in
+	if user.PasswordHash == nil || !hash.CheckPassword(input.Password, *user.PasswordHash) {
 		response.Error(w, http.StatusUnauthorized, "invalid credentials")
 		return
 	}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"expense-sharing-api/internal/models"
+	"expense-sharing-api/pkg/response"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	GroupIDKey   contextKey = "groupID"
+	GroupRoleKey contextKey = "groupRole"
+)
+
+// RoleChecker looks up a user's role in a group, which is empty if the user
+// does not belong to it.
+type RoleChecker interface {
+	GetRole(groupID, userID int) (models.Role, error)
+}
+
+// ArchiveChecker reports whether a group has been archived.
+type ArchiveChecker interface {
+	IsArchived(groupID int) (bool, error)
+}
+
+// GroupMemberMiddleware guards routes below /groups/{id}. The caller must be
+// a member of the group, whose ID and the caller's role in it are then stored
+// in the request context. It must run after AuthMiddleware.
+func GroupMemberMiddleware(groups RoleChecker) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groupID, err := strconv.Atoi(mux.Vars(r)["id"])
+			if err != nil {
+				response.Error(w, http.StatusBadRequest, "invalid group ID")
+				return
+			}
+
+			userID := r.Context().Value(UserIDKey).(int)
+			role, ok := RequireGroupMember(w, groups, groupID, userID)
+			if !ok {
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), GroupIDKey, groupID)
+			ctx = context.WithValue(ctx, GroupRoleKey, role)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireGroupMember returns the user's role in the group and writes an
+// error response if they are not a member. Groups the user is not part of are
+// reported as not found so their IDs are not revealed.
+func RequireGroupMember(w http.ResponseWriter, groups RoleChecker, groupID, userID int) (models.Role, bool) {
+	role, err := groups.GetRole(groupID, userID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group membership")
+		return "", false
+	}
+	if role == "" {
+		response.Error(w, http.StatusNotFound, "group not found")
+		return "", false
+	}
+	return role, true
+}
+
+// Authorize writes a 403 response unless the role grants the permission.
+func Authorize(w http.ResponseWriter, role models.Role, p models.Permission) bool {
+	if !role.Can(p) {
+		response.Error(w, http.StatusForbidden, "your role in this group does not allow this")
+		return false
+	}
+	return true
+}
+
+// RequireActiveGroup writes a 409 response if the group is archived, which
+// makes its expenses and settlements read-only.
+func RequireActiveGroup(w http.ResponseWriter, groups ArchiveChecker, groupID int) bool {
+	archived, err := groups.IsArchived(groupID)
+	if err != nil {
+		response.Error(w, http.StatusInternalServerError, "error checking group status")
+		return false
+	}
+	if archived {
+		response.Error(w, http.StatusConflict, "group is archived, unarchive it to make changes")
+		return false
+	}
+	return true
+}
@@ -1,50 +1,321 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"expense-sharing-api/pkg/money"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"time"
 )
 
+// DateLayout is the format of expense dates.
+const DateLayout = "2006-01-02"
+
 type SplitType string
 
 const (
 	SplitEqual      SplitType = "EQUAL"
 	SplitExact      SplitType = "EXACT"
 	SplitPercentage SplitType = "PERCENTAGE"
+	SplitShares     SplitType = "SHARES"
+	SplitAdjustment SplitType = "ADJUSTMENT"
+	SplitItemized   SplitType = "ITEMIZED"
 )
 
+func (s SplitType) Valid() bool {
+	switch s {
+	case SplitEqual, SplitExact, SplitPercentage, SplitShares, SplitAdjustment, SplitItemized:
+		return true
+	}
+	return false
+}
+
 type Expense struct {
-	ExpenseID   int       `json:"expense_id" db:"expense_id"`
-	GroupID     int       `json:"group_id" db:"group_id"`
-	Description string    `json:"description" db:"description"`
-	Amount      float64   `json:"amount" db:"amount"`
-	CreatedBy   int       `json:"created_by" db:"created_by"`
-	SplitType   SplitType `json:"split_type" db:"split_type"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	Shares      []Share   `json:"shares,omitempty"`
+	ExpenseID   int         `json:"expense_id" db:"expense_id"`
+	GroupID     int         `json:"group_id" db:"group_id"`
+	Description string      `json:"description" db:"description"`
+	Amount      money.Money `json:"amount" db:"amount"`
+	CreatedBy   int         `json:"created_by" db:"created_by"`
+	SplitType   SplitType   `json:"split_type" db:"split_type"`
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	ExpenseDate string      `json:"expense_date" db:"expense_date"` // Day the money was spent, as YYYY-MM-DD
+	// Receipt extras of ITEMIZED expenses, already included in Amount
+	Tax           money.Money `json:"tax,omitempty" db:"tax"`
+	Tip           money.Money `json:"tip,omitempty" db:"tip"`
+	ServiceCharge money.Money `json:"service_charge,omitempty" db:"service_charge"`
+	DeletedAt     *time.Time  `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Amount, shares and payers are in Currency, BaseAmount is the amount
+	// converted to the group's currency, which balances are kept in
+	Currency     string        `json:"currency" db:"currency"`
+	ExchangeRate float64       `json:"exchange_rate" db:"exchange_rate"`
+	BaseAmount   money.Money   `json:"base_amount" db:"base_amount"`
+	Creator      *User         `json:"creator,omitempty"` // Only filled in for a single expense
+	Shares       []Share       `json:"shares,omitempty"`
+	Payers       []Payer       `json:"payers,omitempty"`
+	Items        []ExpenseItem `json:"items,omitempty"`
 }
 
 type Share struct {
-	ExpenseID       int     `json:"expense_id" db:"expense_id"`
-	UserID          int     `json:"user_id" db:"user_id"`
-	ShareAmount     float64 `json:"share_amount" db:"share_amount"`
-	SharePercentage float64 `json:"share_percentage,omitempty" db:"share_percentage"`
-	PaidAmount      float64 `json:"paid_amount" db:"paid_amount"`
+	ExpenseID       int         `json:"expense_id" db:"expense_id"`
+	UserID          int         `json:"user_id" db:"user_id"`
+	ShareAmount     money.Money `json:"share_amount" db:"share_amount"`
+	SharePercentage float64     `json:"share_percentage,omitempty" db:"share_percentage"`
+	PaidAmount      money.Money `json:"paid_amount" db:"paid_amount"`
+	ShareUnits      int         `json:"share_units,omitempty" db:"share_units"`
+	Adjustment      money.Money `json:"adjustment,omitempty" db:"adjustment"`
+}
+
+// Payer records how much a member paid towards an expense.
+type Payer struct {
+	ExpenseID int         `json:"expense_id" db:"expense_id"`
+	UserID    int         `json:"user_id" db:"user_id"`
+	Amount    money.Money `json:"amount" db:"amount"`
+}
+
+// Payments returns how much each member paid towards the expense.
+func (e *Expense) Payments() map[int]money.Money {
+	payments := make(map[int]money.Money, len(e.Payers))
+	for _, payer := range e.Payers {
+		payments[payer.UserID] += payer.Amount
+	}
+	return payments
+}
+
+// Owed returns the share of the expense each participant is responsible for.
+func (e *Expense) Owed() map[int]money.Money {
+	owed := make(map[int]money.Money, len(e.Shares))
+	for _, share := range e.Shares {
+		owed[share.UserID] += share.ShareAmount
+	}
+	return owed
+}
+
+// BasePayments returns how much each member paid towards the expense in the
+// group's currency.
+func (e *Expense) BasePayments() map[int]money.Money {
+	return e.toBase(e.Payments())
+}
+
+// BaseOwed returns the share of the expense each participant is responsible
+// for in the group's currency.
+func (e *Expense) BaseOwed() map[int]money.Money {
+	return e.toBase(e.Owed())
+}
+
+// toBase converts amounts that add up to the expense's amount into the
+// group's currency. The base amount is allocated in proportion to them
+// rather than converting each one separately, so the converted amounts still
+// add up exactly and payments and shares cancel out.
+func (e *Expense) toBase(amounts map[int]money.Money) map[int]money.Money {
+	if e.BaseAmount == e.Amount {
+		return amounts
+	}
+
+	userIDs := make([]int, 0, len(amounts))
+	for userID := range amounts {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Ints(userIDs)
+
+	weights := make([]int64, len(userIDs))
+	for i, userID := range userIDs {
+		weights[i] = amounts[userID].Minor()
+	}
+
+	converted := make(map[int]money.Money, len(userIDs))
+	for i, part := range e.BaseAmount.Allocate(weights) {
+		converted[userIDs[i]] = part
+	}
+	return converted
+}
+
+// ToCreate converts a stored expense back into the input that creates it,
+// so a partial update can be applied on top and validated like a new
+// expense. Shares of itemized expenses are derived from the items and are
+// left out.
+func (e *Expense) ToCreate() ExpenseCreate {
+	input := ExpenseCreate{
+		GroupID:       e.GroupID,
+		Description:   e.Description,
+		Amount:        e.Amount,
+		SplitType:     e.SplitType,
+		Tax:           e.Tax,
+		Tip:           e.Tip,
+		ServiceCharge: e.ServiceCharge,
+		Currency:      e.Currency,
+		ExchangeRate:  e.ExchangeRate,
+		ExpenseDate:   e.ExpenseDate,
+	}
+	if e.SplitType != SplitItemized {
+		for _, share := range e.Shares {
+			input.Shares = append(input.Shares, ShareCreate{
+				UserID:          share.UserID,
+				ShareAmount:     share.ShareAmount,
+				SharePercentage: share.SharePercentage,
+				ShareUnits:      share.ShareUnits,
+				Adjustment:      share.Adjustment,
+			})
+		}
+	}
+	for _, payer := range e.Payers {
+		input.Payers = append(input.Payers, PayerCreate{UserID: payer.UserID, Amount: payer.Amount})
+	}
+	for _, item := range e.Items {
+		input.Items = append(input.Items, ItemCreate{
+			Description:  item.Description,
+			Price:        item.Price,
+			Participants: item.Participants,
+		})
+	}
+	return input
+}
+
+// ApplyPatch returns the expense with the fields of a JSON merge patch applied
+// on top of it. Lists in the patch replace the stored ones outright. When the
+// split type changes without new shares, the stored shares keep only their
+// participants and amounts, and leaving ITEMIZED drops the items and extras.
+func (e *Expense) ApplyPatch(patch []byte) (ExpenseCreate, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return ExpenseCreate{}, err
+	}
+
+	// encoding/json decodes into the elements already in a slice, which would
+	// leave the stored units, adjustments and participants on the new ones
+	input := e.ToCreate()
+	_, hasShares := fields["shares"]
+	_, hasPayers := fields["payers"]
+	_, hasItems := fields["items"]
+	if hasShares {
+		input.Shares = nil
+	}
+	if hasPayers {
+		input.Payers = nil
+	}
+	if hasItems {
+		input.Items = nil
+	}
+	if err := json.Unmarshal(patch, &input); err != nil {
+		return ExpenseCreate{}, err
+	}
+
+	if input.SplitType != e.SplitType {
+		if !hasShares {
+			for i, share := range input.Shares {
+				input.Shares[i] = ShareCreate{UserID: share.UserID, ShareAmount: share.ShareAmount}
+			}
+		}
+		if e.SplitType == SplitItemized && !hasItems {
+			input.Items = nil
+			if _, ok := fields["tax"]; !ok {
+				input.Tax = 0
+			}
+			if _, ok := fields["tip"]; !ok {
+				input.Tip = 0
+			}
+			if _, ok := fields["service_charge"]; !ok {
+				input.ServiceCharge = 0
+			}
+		}
+	}
+
+	// A lone payer paid whatever the expense costs now
+	if !hasPayers && len(input.Payers) == 1 {
+		input.Payers[0].Amount = input.Amount
+	}
+	// The stored rate belongs to the old currency and day
+	if _, ok := fields["exchange_rate"]; !ok && (input.Currency != e.Currency || input.ExpenseDate != e.ExpenseDate) {
+		input.ExchangeRate = 0
+	}
+
+	return input, nil
 }
 
 type ExpenseCreate struct {
-	GroupID     int           `json:"group_id"`
-	Description string        `json:"description"`
-	Amount      float64       `json:"amount"`
-	SplitType   SplitType     `json:"split_type"`
-	Shares      []ShareCreate `json:"shares"`
+	GroupID       int           `json:"group_id"`
+	Description   string        `json:"description"`
+	Amount        money.Money   `json:"amount"`
+	SplitType     SplitType     `json:"split_type"`
+	Shares        []ShareCreate `json:"shares"`
+	Payers        []PayerCreate `json:"payers,omitempty"`
+	Items         []ItemCreate  `json:"items,omitempty"`
+	Tax           money.Money   `json:"tax,omitempty"`
+	Tip           money.Money   `json:"tip,omitempty"`
+	ServiceCharge money.Money   `json:"service_charge,omitempty"`
+	Currency      string        `json:"currency,omitempty"`      // Defaults to the group's currency
+	ExchangeRate  float64       `json:"exchange_rate,omitempty"` // Group currency per unit of Currency
+	ExpenseDate   string        `json:"expense_date,omitempty"`  // YYYY-MM-DD, defaults to the day it is recorded
 }
 
 type ShareCreate struct {
-	UserID          int     `json:"user_id"`
-	ShareAmount     float64 `json:"share_amount,omitempty"`
-	SharePercentage float64 `json:"share_percentage,omitempty"`
-	PaidAmount      float64 `json:"paid_amount"`
+	UserID          int         `json:"user_id"`
+	ShareAmount     money.Money `json:"share_amount,omitempty"`
+	SharePercentage float64     `json:"share_percentage,omitempty"`
+	PaidAmount      money.Money `json:"paid_amount"` // Deprecated: use ExpenseCreate.Payers
+	ShareUnits      int         `json:"share_units,omitempty"`
+	Adjustment      money.Money `json:"adjustment,omitempty"` // Signed, ADJUSTMENT splits only
+}
+
+type PayerCreate struct {
+	UserID int         `json:"user_id"`
+	Amount money.Money `json:"amount"`
+}
+
+// ApplyDefaults fills in the group's default split type and participants
+// when the request leaves them out. Default participants of SHARES splits get
+// one unit each.
+func (e *ExpenseCreate) ApplyDefaults(group *Group) {
+	if e.SplitType == "" && group.DefaultSplitType != nil {
+		e.SplitType = *group.DefaultSplitType
+	}
+	if len(e.Shares) == 0 && e.SplitType != SplitItemized {
+		for _, userID := range group.DefaultParticipants {
+			share := ShareCreate{UserID: userID}
+			if e.SplitType == SplitShares {
+				share.ShareUnits = 1
+			}
+			e.Shares = append(e.Shares, share)
+		}
+	}
+}
+
+// ValidateCurrency checks the expense's currency and exchange rate against
+// the group's currency, which the expense defaults to. Expenses in the
+// group's currency always have a rate of 1.
+func (e *ExpenseCreate) ValidateCurrency(baseCurrency string) error {
+	if e.Currency == "" {
+		e.Currency = baseCurrency
+	}
+	e.Currency = strings.ToUpper(e.Currency)
+	if !money.IsCurrencyCode(e.Currency) {
+		return errors.New("currency must be a three-letter ISO 4217 code")
+	}
+	if !money.IsSupportedCurrency(e.Currency) {
+		return fmt.Errorf("%s has %d decimal places, only currencies with 2 are supported", e.Currency, money.Decimals(e.Currency))
+	}
+
+	if e.Currency == baseCurrency {
+		if e.ExchangeRate == 0 {
+			e.ExchangeRate = 1
+		}
+		if e.ExchangeRate != 1 {
+			return fmt.Errorf("exchange rate must be 1 for expenses in the group's currency (%s)", baseCurrency)
+		}
+		return nil
+	}
+	if e.ExchangeRate == 0 {
+		return fmt.Errorf("no exchange rate from %s to the group's currency (%s) is on file, exchange_rate is required", e.Currency, baseCurrency)
+	}
+	if e.ExchangeRate < 0 || math.IsInf(e.ExchangeRate, 0) || math.IsNaN(e.ExchangeRate) {
+		return errors.New("exchange rate must be greater than 0")
+	}
+	if _, err := e.Amount.Convert(e.ExchangeRate); err != nil {
+		return errors.New("amount is too large to convert at this exchange rate")
+	}
+	return nil
 }
 
 func (e *ExpenseCreate) Validate() error {
@@ -57,9 +328,33 @@ func (e *ExpenseCreate) Validate() error {
 	if e.Amount <= 0 {
 		return errors.New("amount must be greater than 0")
 	}
-	if len(e.Shares) == 0 {
+	if e.ExpenseDate != "" {
+		if _, err := time.Parse(DateLayout, e.ExpenseDate); err != nil {
+			return errors.New("expense date must be formatted as YYYY-MM-DD")
+		}
+	}
+	// Itemized expenses derive their participants from the items
+	if len(e.Shares) == 0 && e.SplitType != SplitItemized {
 		return errors.New("at least one share is required")
 	}
+	if e.SplitType != SplitItemized && (len(e.Items) > 0 || e.extras() != 0) {
+		return errors.New("items, tax, tip and service charge are only allowed for ITEMIZED splits")
+	}
+	for _, share := range e.Shares {
+		if share.UserID == 0 {
+			return errors.New("user ID is required for every share")
+		}
+		if share.ShareAmount < 0 || share.PaidAmount < 0 || share.SharePercentage < 0 || share.ShareUnits < 0 {
+			return errors.New("share amounts, percentages and units cannot be negative")
+		}
+		if share.Adjustment != 0 && e.SplitType != SplitAdjustment {
+			return errors.New("adjustments are only allowed for ADJUSTMENT splits")
+		}
+	}
+
+	if err := e.validatePayers(); err != nil {
+		return err
+	}
 
 	switch e.SplitType {
 	case SplitEqual:
@@ -68,23 +363,135 @@ func (e *ExpenseCreate) Validate() error {
 		return e.validateExactSplit()
 	case SplitPercentage:
 		return e.validatePercentageSplit()
+	case SplitShares:
+		return e.validateSharesSplit()
+	case SplitAdjustment:
+		return e.validateAdjustmentSplit()
+	case SplitItemized:
+		return e.validateItemizedSplit()
 	default:
 		return errors.New("invalid split type")
 	}
 }
 
-func (e *ExpenseCreate) validateEqualSplit() error {
-	shareAmount := e.Amount / float64(len(e.Shares))
+// validatePayers checks that the payers account for exactly the total
+// amount. Older clients record payments as paid_amount on the shares instead,
+// which may not be combined with payers and may leave a remainder that the
+// creator is assumed to have paid.
+func (e *ExpenseCreate) validatePayers() error {
+	var paidOnShares money.Money
+	for _, share := range e.Shares {
+		paidOnShares += share.PaidAmount
+	}
+
+	if len(e.Payers) == 0 {
+		if paidOnShares > e.Amount {
+			return errors.New("paid amounts cannot exceed the total amount")
+		}
+		return nil
+	}
+	if paidOnShares != 0 {
+		return errors.New("paid_amount on shares cannot be combined with payers")
+	}
+
+	var total money.Money
+	seen := make(map[int]bool, len(e.Payers))
+	for _, payer := range e.Payers {
+		if payer.UserID == 0 {
+			return errors.New("user ID is required for every payer")
+		}
+		if payer.Amount <= 0 {
+			return errors.New("payer amounts must be greater than 0")
+		}
+		if seen[payer.UserID] {
+			return errors.New("each payer may only be listed once")
+		}
+		seen[payer.UserID] = true
+		total += payer.Amount
+	}
+	if total != e.Amount {
+		return errors.New("sum of payer amounts must equal total amount")
+	}
+	return nil
+}
+
+// ValidateMembers checks that everyone the expense names, as participant,
+// payer or on a receipt item, is one of the given group members and is only
+// listed once. It returns an error message per offending field, keyed by its
+// position in the request such as "shares[1].user_id".
+func (e *ExpenseCreate) ValidateMembers(memberIDs []int) map[string]string {
+	members := make(map[int]bool, len(memberIDs))
+	for _, userID := range memberIDs {
+		members[userID] = true
+	}
+
+	errs := make(map[string]string)
+	check := func(field string, userID int, seen map[int]bool) {
+		switch {
+		case !members[userID]:
+			errs[field] = fmt.Sprintf("user %d is not a member of the group", userID)
+		case seen[userID]:
+			errs[field] = fmt.Sprintf("user %d is listed more than once", userID)
+		}
+		seen[userID] = true
+	}
+
+	seen := make(map[int]bool, len(e.Shares))
+	for i, share := range e.Shares {
+		check(fmt.Sprintf("shares[%d].user_id", i), share.UserID, seen)
+	}
+	seen = make(map[int]bool, len(e.Payers))
+	for i, payer := range e.Payers {
+		check(fmt.Sprintf("payers[%d].user_id", i), payer.UserID, seen)
+	}
+	for i, item := range e.Items {
+		seen = make(map[int]bool, len(item.Participants))
+		for j, userID := range item.Participants {
+			check(fmt.Sprintf("items[%d].participants[%d]", i, j), userID, seen)
+		}
+	}
+	return errs
+}
+
+// ResolvePayers fills in Payers for clients that only sent paid_amount on the
+// shares, or no payments at all. Whatever is not accounted for was paid by
+// the creator. It must be called after Validate.
+func (e *ExpenseCreate) ResolvePayers(createdBy int) {
+	if len(e.Payers) > 0 {
+		return
+	}
+
+	var paid money.Money
+	creatorPaid := false
 	for _, share := range e.Shares {
-		if share.ShareAmount != shareAmount {
-			return errors.New("all shares must be equal")
+		if share.PaidAmount > 0 {
+			e.Payers = append(e.Payers, PayerCreate{UserID: share.UserID, Amount: share.PaidAmount})
+			paid += share.PaidAmount
+		}
+	}
+	remainder := e.Amount - paid
+	for i := range e.Payers {
+		if e.Payers[i].UserID == createdBy && remainder > 0 {
+			e.Payers[i].Amount += remainder
+			creatorPaid = true
 		}
 	}
+	if remainder > 0 && !creatorPaid {
+		e.Payers = append(e.Payers, PayerCreate{UserID: createdBy, Amount: remainder})
+	}
+}
+
+// validateEqualSplit only needs the participant list, the share amounts are
+// calculated by CalculateShares.
+func (e *ExpenseCreate) validateEqualSplit() error {
+	if e.Amount < money.Money(len(e.Shares)) {
+		return errors.New("amount is too small to split between all participants")
+	}
 	return nil
 }
 
 func (e *ExpenseCreate) validateExactSplit() error {
-	var total float64
+	var total money.Money
 	for _, share := range e.Shares {
 		total += share.ShareAmount
 	}
@@ -95,12 +502,71 @@ func (e *ExpenseCreate) validateExactSplit() error {
 }
 
 func (e *ExpenseCreate) validatePercentageSplit() error {
-	var total float64
+	// Percentages carry two decimal places, compare them in hundredths so
+	// 33.33 + 33.33 + 33.34 adds up exactly
+	var total int64
 	for _, share := range e.Shares {
-		total += share.SharePercentage
+		total += hundredths(share.SharePercentage)
 	}
-	if total != 100 {
+	if total != 100*100 {
 		return errors.New("sum of percentages must equal 100")
 	}
 	return nil
 }
+
+func (e *ExpenseCreate) validateSharesSplit() error {
+	for _, share := range e.Shares {
+		if share.ShareUnits == 0 {
+			return errors.New("every participant must have at least one share unit")
+		}
+	}
+	return nil
+}
+
+// validateAdjustmentSplit checks that the adjustments leave a non-negative
+// amount to divide equally and that nobody ends up with a negative share.
+func (e *ExpenseCreate) validateAdjustmentSplit() error {
+	var adjustments money.Money
+	for _, share := range e.Shares {
+		adjustments += share.Adjustment
+	}
+	remaining := e.Amount - adjustments
+	if remaining < 0 {
+		return errors.New("adjustments cannot exceed the total amount")
+	}
+
+	equalPart := remaining / money.Money(len(e.Shares))
+	for _, share := range e.Shares {
+		if equalPart+share.Adjustment < 0 {
+			return errors.New("adjustment would make a share negative")
+		}
+	}
+	return nil
+}
+
+func (e *ExpenseCreate) validateItemizedSplit() error {
+	if len(e.Items) == 0 {
+		return errors.New("at least one item is required")
+	}
+	if e.Tax < 0 || e.Tip < 0 || e.ServiceCharge < 0 {
+		return errors.New("tax, tip and service charge cannot be negative")
+	}
+
+	total := e.extras()
+	for i := range e.Items {
+		if err := e.Items[i].Validate(); err != nil {
+			return err
+		}
+		total += e.Items[i].Price
+	}
+	if total != e.Amount {
+		return errors.New("items plus tax, tip and service charge must equal total amount")
+	}
+	return nil
+}
+
+// extras returns the receipt charges that are shared in proportion to each
+// participant's item subtotal.
+func (e *ExpenseCreate) extras() money.Money {
+	return e.Tax + e.Tip + e.ServiceCharge
+}
@@ -0,0 +1,258 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateMembers(t *testing.T) {
+	members := []int{1, 2, 3}
+
+	tests := []struct {
+		name  string
+		input ExpenseCreate
+		want  map[string]string
+	}{
+		{
+			name: "everyone is a member",
+			input: ExpenseCreate{
+				Shares: []ShareCreate{{UserID: 1}, {UserID: 2}},
+				Payers: []PayerCreate{{UserID: 1}, {UserID: 3}},
+				Items:  []ItemCreate{{Participants: []int{1, 2}}, {Participants: []int{1, 3}}},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "participant outside the group",
+			input: ExpenseCreate{
+				Shares: []ShareCreate{{UserID: 1}, {UserID: 9}},
+				Payers: []PayerCreate{{UserID: 1}},
+			},
+			want: map[string]string{"shares[1].user_id": "user 9 is not a member of the group"},
+		},
+		{
+			name: "payer outside the group",
+			input: ExpenseCreate{
+				Shares: []ShareCreate{{UserID: 1}},
+				Payers: []PayerCreate{{UserID: 4}},
+			},
+			want: map[string]string{"payers[0].user_id": "user 4 is not a member of the group"},
+		},
+		{
+			name: "listed twice",
+			input: ExpenseCreate{
+				Shares: []ShareCreate{{UserID: 2}, {UserID: 1}, {UserID: 2}},
+				Payers: []PayerCreate{{UserID: 1}, {UserID: 1}},
+			},
+			want: map[string]string{
+				"shares[2].user_id": "user 2 is listed more than once",
+				"payers[1].user_id": "user 1 is listed more than once",
+			},
+		},
+		{
+			name: "item participants are checked per item",
+			input: ExpenseCreate{
+				Shares: []ShareCreate{{UserID: 1}},
+				Items: []ItemCreate{
+					{Participants: []int{1, 2}},
+					{Participants: []int{2, 5, 2}},
+				},
+			},
+			want: map[string]string{
+				"items[1].participants[1]": "user 5 is not a member of the group",
+				"items[1].participants[2]": "user 2 is listed more than once",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.input.ValidateMembers(members); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateMembers(%v) = %v, want %v", members, got, tt.want)
+			}
+		})
+	}
+}
+
+func storedExpense(splitType SplitType, shares ...Share) *Expense {
+	return &Expense{
+		ExpenseID:    1,
+		GroupID:      1,
+		Description:  "Dinner",
+		Amount:       9000,
+		SplitType:    splitType,
+		Currency:     "USD",
+		ExchangeRate: 1,
+		Shares:       shares,
+		Payers:       []Payer{{ExpenseID: 1, UserID: 1, Amount: 9000}},
+	}
+}
+
+func TestApplyPatchSwitchesSplitType(t *testing.T) {
+	shares := storedExpense(SplitShares,
+		Share{UserID: 1, ShareAmount: 6000, ShareUnits: 2},
+		Share{UserID: 2, ShareAmount: 3000, ShareUnits: 1},
+	)
+	adjustment := storedExpense(SplitAdjustment,
+		Share{UserID: 1, ShareAmount: 5500, Adjustment: 1000},
+		Share{UserID: 2, ShareAmount: 3500},
+	)
+	percentage := storedExpense(SplitPercentage,
+		Share{UserID: 1, ShareAmount: 4500, SharePercentage: 50},
+		Share{UserID: 2, ShareAmount: 4500, SharePercentage: 50},
+	)
+
+	tests := []struct {
+		name    string
+		stored  *Expense
+		patch   string
+		want    []ShareCreate
+		wantErr string
+	}{
+		{
+			name:   "new shares do not inherit stored units",
+			stored: shares,
+			patch:  `{"split_type": "EQUAL", "shares": [{"user_id": 2}, {"user_id": 3}]}`,
+			want:   []ShareCreate{{UserID: 2}, {UserID: 3}},
+		},
+		{
+			name:   "new shares do not inherit stored adjustments",
+			stored: adjustment,
+			patch:  `{"split_type": "EQUAL", "shares": [{"user_id": 1}, {"user_id": 2}]}`,
+			want:   []ShareCreate{{UserID: 1}, {UserID: 2}},
+		},
+		{
+			name:   "stored participants are kept without their split data",
+			stored: adjustment,
+			patch:  `{"split_type": "EQUAL"}`,
+			want:   []ShareCreate{{UserID: 1, ShareAmount: 5500}, {UserID: 2, ShareAmount: 3500}},
+		},
+		{
+			name:   "stored amounts carry over to an exact split",
+			stored: percentage,
+			patch:  `{"split_type": "EXACT"}`,
+			want:   []ShareCreate{{UserID: 1, ShareAmount: 4500}, {UserID: 2, ShareAmount: 4500}},
+		},
+		{
+			name:    "a weighted split needs new units",
+			stored:  adjustment,
+			patch:   `{"split_type": "SHARES"}`,
+			want:    []ShareCreate{{UserID: 1, ShareAmount: 5500}, {UserID: 2, ShareAmount: 3500}},
+			wantErr: "every participant must have at least one share unit",
+		},
+		{
+			name:   "shares are kept as they are when the split type stays",
+			stored: shares,
+			patch:  `{"description": "Team dinner"}`,
+			want: []ShareCreate{
+				{UserID: 1, ShareAmount: 6000, ShareUnits: 2},
+				{UserID: 2, ShareAmount: 3000, ShareUnits: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := tt.stored.ApplyPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("ApplyPatch(%s) returned error %v", tt.patch, err)
+			}
+			if !reflect.DeepEqual(input.Shares, tt.want) {
+				t.Errorf("ApplyPatch(%s) shares = %+v, want %+v", tt.patch, input.Shares, tt.want)
+			}
+
+			err = input.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() after ApplyPatch(%s) = %v, want no error", tt.patch, err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Validate() after ApplyPatch(%s) = %v, want %q", tt.patch, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyPatchReplacesLists(t *testing.T) {
+	stored := storedExpense(SplitEqual, Share{UserID: 1, ShareAmount: 4500}, Share{UserID: 2, ShareAmount: 4500})
+	stored.Payers = []Payer{{UserID: 1, Amount: 6000}, {UserID: 2, Amount: 3000}}
+
+	input, err := stored.ApplyPatch([]byte(`{"payers": [{"user_id": 2, "amount": "90.00"}]}`))
+	if err != nil {
+		t.Fatalf("ApplyPatch returned error %v", err)
+	}
+	if want := []PayerCreate{{UserID: 2, Amount: 9000}}; !reflect.DeepEqual(input.Payers, want) {
+		t.Errorf("payers = %+v, want %+v", input.Payers, want)
+	}
+
+	itemized := storedExpense(SplitItemized)
+	itemized.Tax = 500
+	itemized.Items = []ExpenseItem{
+		{Description: "Pizza", Price: 5000, Participants: []int{1, 2, 3}},
+		{Description: "Wine", Price: 3500, Participants: []int{1, 2}},
+	}
+
+	input, err = itemized.ApplyPatch([]byte(`{"items": [{"description": "Pizza", "price": "85.00", "participants": [2]}]}`))
+	if err != nil {
+		t.Fatalf("ApplyPatch returned error %v", err)
+	}
+	if want := []ItemCreate{{Description: "Pizza", Price: 8500, Participants: []int{2}}}; !reflect.DeepEqual(input.Items, want) {
+		t.Errorf("items = %+v, want %+v", input.Items, want)
+	}
+	if input.Tax != 500 {
+		t.Errorf("tax = %v, want the stored 5.00", input.Tax)
+	}
+}
+
+func TestApplyPatchLeavesItemized(t *testing.T) {
+	stored := storedExpense(SplitItemized)
+	stored.Tax = 500
+	stored.Tip = 1000
+	stored.Items = []ExpenseItem{{Description: "Pizza", Price: 7500, Participants: []int{1, 2}}}
+
+	input, err := stored.ApplyPatch([]byte(`{"split_type": "EQUAL", "shares": [{"user_id": 1}, {"user_id": 2}]}`))
+	if err != nil {
+		t.Fatalf("ApplyPatch returned error %v", err)
+	}
+	if len(input.Items) != 0 || input.Tax != 0 || input.Tip != 0 {
+		t.Errorf("items = %+v, tax = %v, tip = %v, want them dropped", input.Items, input.Tax, input.Tip)
+	}
+	if err := input.Validate(); err != nil {
+		t.Errorf("Validate() = %v, want no error", err)
+	}
+}
+
+func TestApplyPatchInvalid(t *testing.T) {
+	stored := storedExpense(SplitEqual, Share{UserID: 1, ShareAmount: 9000})
+	for _, patch := range []string{``, `[]`, `{"amount": "1.234"}`, `{"shares": {}}`} {
+		if _, err := stored.ApplyPatch([]byte(patch)); err == nil {
+			t.Errorf("ApplyPatch(%s) returned no error", patch)
+		}
+	}
+}
+
+func TestApplyPatchExchangeRate(t *testing.T) {
+	stored := storedExpense(SplitEqual, Share{UserID: 1, ShareAmount: 9000})
+	stored.Currency = "EUR"
+	stored.ExchangeRate = 1.1
+	stored.ExpenseDate = "2024-01-02"
+
+	tests := []struct {
+		patch string
+		want  float64
+	}{
+		{`{"description": "Team dinner"}`, 1.1},
+		{`{"expense_date": "2024-01-02"}`, 1.1},
+		{`{"expense_date": "2023-12-29"}`, 0},
+		{`{"currency": "GBP"}`, 0},
+		{`{"expense_date": "2023-12-29", "exchange_rate": 1.2}`, 1.2},
+	}
+	for _, tt := range tests {
+		input, err := stored.ApplyPatch([]byte(tt.patch))
+		if err != nil {
+			t.Fatalf("ApplyPatch(%s) returned error %v", tt.patch, err)
+		}
+		if input.ExchangeRate != tt.want {
+			t.Errorf("ApplyPatch(%s) exchange rate = %v, want %v", tt.patch, input.ExchangeRate, tt.want)
+		}
+	}
+}
@@ -2,16 +2,48 @@ package models
 
 import (
 	"errors"
+	"expense-sharing-api/pkg/money"
+	"fmt"
+	"strings"
 	"time"
 )
 
 type Group struct {
-	GroupID     int       `json:"group_id" db:"group_id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	CreatedBy   int       `json:"created_by" db:"created_by"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	Members     []User    `json:"members,omitempty"`
+	GroupID     int        `json:"group_id" db:"group_id"`
+	Name        string     `json:"name" db:"name"`
+	Description string     `json:"description" db:"description"`
+	CreatedBy   int        `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty" db:"archived_at"` // Archived groups are read-only
+	// Settings, the defaults apply to new expenses that leave the fields out
+	DefaultCurrency      string     `json:"default_currency" db:"default_currency"`
+	DefaultSplitType     *SplitType `json:"default_split_type,omitempty" db:"default_split_type"`
+	DefaultParticipants  []int      `json:"default_participants,omitempty"` // Only filled in for a single group
+	MembersCanEditOthers bool       `json:"members_can_edit_others" db:"members_can_edit_others"`
+	Members              []Member   `json:"members,omitempty"`
+}
+
+// GroupFilter selects groups by whether they are archived.
+type GroupFilter string
+
+const (
+	GroupsActive   GroupFilter = "active"
+	GroupsArchived GroupFilter = "archived"
+	GroupsAll      GroupFilter = "all"
+)
+
+func (f GroupFilter) Valid() bool {
+	switch f {
+	case GroupsActive, GroupsArchived, GroupsAll:
+		return true
+	}
+	return false
+}
+
+// Member is a user together with their role in a group.
+type Member struct {
+	User
+	Role Role `json:"role" db:"role"`
 }
 
 type GroupCreate struct {
@@ -29,3 +61,122 @@ func (g *GroupCreate) Validate() error {
 	}
 	return nil
 }
+
+type MemberAdd struct {
+	UserID int  `json:"user_id"`
+	Role   Role `json:"role"` // Defaults to member
+}
+
+func (m *MemberAdd) Validate() error {
+	if m.UserID == 0 {
+		return errors.New("user ID is required")
+	}
+	if m.Role == "" {
+		m.Role = RoleMember
+	}
+	if !m.Role.Valid() || m.Role == RoleOwner {
+		return errors.New("role must be admin, member or viewer")
+	}
+	return nil
+}
+
+// GroupUpdate changes the fields that are present. An empty
+// default_split_type clears it and an empty default_participants list
+// removes all default participants.
+type GroupUpdate struct {
+	Name                 *string    `json:"name"`
+	Description          *string    `json:"description"`
+	DefaultCurrency      *string    `json:"default_currency"`
+	DefaultSplitType     *SplitType `json:"default_split_type"`
+	DefaultParticipants  *[]int     `json:"default_participants"`
+	MembersCanEditOthers *bool      `json:"members_can_edit_others"`
+}
+
+func (g *GroupUpdate) Validate() error {
+	if g.Name != nil && *g.Name == "" {
+		return errors.New("group name cannot be empty")
+	}
+	if g.DefaultCurrency != nil {
+		*g.DefaultCurrency = strings.ToUpper(*g.DefaultCurrency)
+		if !money.IsCurrencyCode(*g.DefaultCurrency) {
+			return errors.New("default currency must be a three-letter ISO 4217 code")
+		}
+		if !money.IsSupportedCurrency(*g.DefaultCurrency) {
+			return fmt.Errorf("%s has %d decimal places, only currencies with 2 are supported", *g.DefaultCurrency, money.Decimals(*g.DefaultCurrency))
+		}
+	}
+	if g.DefaultSplitType != nil && *g.DefaultSplitType != "" && !g.DefaultSplitType.Valid() {
+		return errors.New("invalid default split type")
+	}
+	return nil
+}
+
+// ValidateMembers checks that the default participants are members of the
+// group and are only listed once, keyed like ExpenseCreate.ValidateMembers.
+func (g *GroupUpdate) ValidateMembers(memberIDs []int) map[string]string {
+	errs := make(map[string]string)
+	if g.DefaultParticipants == nil {
+		return errs
+	}
+
+	members := make(map[int]bool, len(memberIDs))
+	for _, userID := range memberIDs {
+		members[userID] = true
+	}
+	seen := make(map[int]bool, len(*g.DefaultParticipants))
+	for i, userID := range *g.DefaultParticipants {
+		field := fmt.Sprintf("default_participants[%d]", i)
+		switch {
+		case !members[userID]:
+			errs[field] = fmt.Sprintf("user %d is not a member of the group", userID)
+		case seen[userID]:
+			errs[field] = fmt.Sprintf("user %d is listed more than once", userID)
+		}
+		seen[userID] = true
+	}
+	return errs
+}
+
+type RoleUpdate struct {
+	Role Role `json:"role"`
+}
+
+func (r *RoleUpdate) Validate() error {
+	if !r.Role.Valid() || r.Role == RoleOwner {
+		return errors.New("role must be admin, member or viewer, use an ownership transfer to change the owner")
+	}
+	return nil
+}
+
+type OwnershipTransfer struct {
+	UserID int `json:"user_id"`
+}
+
+func (o *OwnershipTransfer) Validate() error {
+	if o.UserID == 0 {
+		return errors.New("user ID is required")
+	}
+	return nil
+}
+
+type GuestCreate struct {
+	FullName string `json:"full_name"`
+}
+
+func (g *GuestCreate) Validate() error {
+	if g.FullName == "" {
+		return errors.New("full name is required")
+	}
+	return nil
+}
+
+type GuestMerge struct {
+	UserID int `json:"user_id"` // Registered member taking over the guest's records
+}
+
+func (g *GuestMerge) Validate() error {
+	if g.UserID == 0 {
+		return errors.New("user ID is required")
+	}
+	return nil
+}
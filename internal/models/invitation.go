@@ -0,0 +1,91 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type InvitationStatus string
+
+const (
+	InvitationPending  InvitationStatus = "pending"
+	InvitationAccepted InvitationStatus = "accepted"
+	InvitationRevoked  InvitationStatus = "revoked"
+	InvitationExpired  InvitationStatus = "expired"
+)
+
+// Invitation asks someone, who may not have an account yet, by email to
+// join a group. Redeeming its token makes them a member.
+type Invitation struct {
+	InvitationID int              `json:"invitation_id" db:"invitation_id"`
+	GroupID      int              `json:"group_id" db:"group_id"`
+	GroupName    string           `json:"group_name" db:"group_name"`
+	Email        string           `json:"email" db:"email"`
+	Role         Role             `json:"role" db:"role"`
+	Token        string           `json:"token" db:"token"`
+	InvitedBy    int              `json:"invited_by" db:"invited_by"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time        `json:"expires_at" db:"expires_at"`
+	AcceptedAt   *time.Time       `json:"accepted_at,omitempty" db:"accepted_at"`
+	AcceptedBy   *int             `json:"accepted_by,omitempty" db:"accepted_by"`
+	RevokedAt    *time.Time       `json:"revoked_at,omitempty" db:"revoked_at"`
+	Status       InvitationStatus `json:"status" db:"status"`
+}
+
+// CheckRedeemable returns why the user with the given email cannot redeem
+// the invitation, if anything stops them.
+func (i *Invitation) CheckRedeemable(email string) error {
+	switch i.Status {
+	case InvitationAccepted:
+		return errors.New("invitation has already been accepted")
+	case InvitationRevoked:
+		return errors.New("invitation has been revoked")
+	case InvitationExpired:
+		return errors.New("invitation has expired")
+	}
+	if !strings.EqualFold(i.Email, email) {
+		return errors.New("invitation was sent to a different email address")
+	}
+	return nil
+}
+
+type InvitationCreate struct {
+	Email         string `json:"email"`
+	Role          Role   `json:"role"`            // Defaults to member
+	ExpiresInDays int    `json:"expires_in_days"` // Defaults to 7
+}
+
+func (i *InvitationCreate) Validate() error {
+	if i.Email == "" {
+		return errors.New("email is required")
+	}
+	if !regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`).MatchString(i.Email) {
+		return errors.New("invalid email format")
+	}
+	if i.Role == "" {
+		i.Role = RoleMember
+	}
+	if !i.Role.Valid() || i.Role == RoleOwner {
+		return errors.New("role must be admin, member or viewer")
+	}
+	if i.ExpiresInDays == 0 {
+		i.ExpiresInDays = 7
+	}
+	if i.ExpiresInDays < 1 || i.ExpiresInDays > 90 {
+		return errors.New("invitations must expire within 1 to 90 days")
+	}
+	return nil
+}
+
+type InvitationAccept struct {
+	Token string `json:"token"`
+}
+
+func (i *InvitationAccept) Validate() error {
+	if i.Token == "" {
+		return errors.New("token is required")
+	}
+	return nil
+}
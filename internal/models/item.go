@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"expense-sharing-api/pkg/money"
+)
+
+// ExpenseItem is a line of an itemized receipt and the members who shared it.
+type ExpenseItem struct {
+	ItemID       int         `json:"item_id" db:"item_id"`
+	ExpenseID    int         `json:"expense_id" db:"expense_id"`
+	Description  string      `json:"description" db:"description"`
+	Price        money.Money `json:"price" db:"price"`
+	Participants []int       `json:"participants"`
+}
+
+type ItemCreate struct {
+	Description  string      `json:"description"`
+	Price        money.Money `json:"price"`
+	Participants []int       `json:"participants"` // User IDs
+}
+
+func (i *ItemCreate) Validate() error {
+	if i.Description == "" {
+		return errors.New("item description is required")
+	}
+	if i.Price <= 0 {
+		return errors.New("item price must be greater than 0")
+	}
+	if len(i.Participants) == 0 {
+		return errors.New("every item needs at least one participant")
+	}
+	seen := make(map[int]bool, len(i.Participants))
+	for _, userID := range i.Participants {
+		if userID == 0 {
+			return errors.New("item participants must be valid user IDs")
+		}
+		if seen[userID] {
+			return errors.New("item participants must be unique")
+		}
+		seen[userID] = true
+	}
+	return nil
+}
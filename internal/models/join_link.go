@@ -0,0 +1,105 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+type JoinLinkStatus string
+
+const (
+	JoinLinkActive    JoinLinkStatus = "active"
+	JoinLinkRevoked   JoinLinkStatus = "revoked"
+	JoinLinkExpired   JoinLinkStatus = "expired"
+	JoinLinkExhausted JoinLinkStatus = "exhausted"
+)
+
+// JoinLink is a shareable token that lets anyone holding it join a group,
+// either straight away or after an admin approves their request.
+type JoinLink struct {
+	LinkID           int            `json:"link_id" db:"link_id"`
+	GroupID          int            `json:"group_id" db:"group_id"`
+	GroupName        string         `json:"group_name" db:"group_name"`
+	Token            string         `json:"token" db:"token"`
+	Role             Role           `json:"role" db:"role"`
+	RequiresApproval bool           `json:"requires_approval" db:"requires_approval"`
+	MaxUses          *int           `json:"max_uses,omitempty" db:"max_uses"`
+	Uses             int            `json:"uses" db:"uses"`
+	CreatedBy        int            `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time      `json:"created_at" db:"created_at"`
+	ExpiresAt        *time.Time     `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt        *time.Time     `json:"revoked_at,omitempty" db:"revoked_at"`
+	Status           JoinLinkStatus `json:"status" db:"status"`
+}
+
+// CheckUsable returns why the link can no longer be used to join, if anything
+// stops it.
+func (l *JoinLink) CheckUsable() error {
+	switch l.Status {
+	case JoinLinkRevoked:
+		return errors.New("join link has been revoked")
+	case JoinLinkExpired:
+		return errors.New("join link has expired")
+	case JoinLinkExhausted:
+		return errors.New("join link has reached its usage limit")
+	}
+	return nil
+}
+
+type JoinLinkCreate struct {
+	Role             Role `json:"role"`              // Defaults to member
+	RequiresApproval bool `json:"requires_approval"` // Joiners wait for an admin
+	MaxUses          *int `json:"max_uses"`          // Unlimited if omitted
+	ExpiresInDays    *int `json:"expires_in_days"`   // Never expires if omitted
+}
+
+func (l *JoinLinkCreate) Validate() error {
+	if l.Role == "" {
+		l.Role = RoleMember
+	}
+	if !l.Role.Valid() || l.Role == RoleOwner {
+		return errors.New("role must be admin, member or viewer")
+	}
+	if l.MaxUses != nil && *l.MaxUses < 1 {
+		return errors.New("max_uses must be at least 1")
+	}
+	if l.ExpiresInDays != nil && (*l.ExpiresInDays < 1 || *l.ExpiresInDays > 365) {
+		return errors.New("join links must expire within 1 to 365 days")
+	}
+	return nil
+}
+
+type JoinLinkRedeem struct {
+	Token string `json:"token"`
+}
+
+func (l *JoinLinkRedeem) Validate() error {
+	if l.Token == "" {
+		return errors.New("token is required")
+	}
+	return nil
+}
+
+type JoinRequestStatus string
+
+const (
+	JoinRequestPending  JoinRequestStatus = "pending"
+	JoinRequestApproved JoinRequestStatus = "approved"
+	JoinRequestRejected JoinRequestStatus = "rejected"
+)
+
+// JoinRequest is created when someone uses a join link that requires
+// approval. They become a member once an admin approves it.
+type JoinRequest struct {
+	RequestID int               `json:"request_id" db:"request_id"`
+	GroupID   int               `json:"group_id" db:"group_id"`
+	LinkID    int               `json:"link_id" db:"link_id"`
+	UserID    int               `json:"user_id" db:"user_id"`
+	FullName  string            `json:"full_name" db:"full_name"`
+	Email     string            `json:"email" db:"email"`
+	Role      Role              `json:"role" db:"role"`
+	Status    JoinRequestStatus `json:"status" db:"status"`
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+	DecidedAt *time.Time        `json:"decided_at,omitempty" db:"decided_at"`
+	DecidedBy *int              `json:"decided_by,omitempty" db:"decided_by"`
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type RevisionAction string
+
+const (
+	RevisionCreate  RevisionAction = "CREATE"
+	RevisionUpdate  RevisionAction = "UPDATE"
+	RevisionDelete  RevisionAction = "DELETE"
+	RevisionRestore RevisionAction = "RESTORE"
+)
+
+// ExpenseRevision is an immutable snapshot of an expense with its shares,
+// payers and items, taken every time the expense changes.
+type ExpenseRevision struct {
+	RevisionID int            `json:"revision_id" db:"revision_id"`
+	ExpenseID  int            `json:"expense_id" db:"expense_id"`
+	Action     RevisionAction `json:"action" db:"action"`
+	ChangedBy  int            `json:"changed_by" db:"changed_by"`
+	ChangedAt  time.Time      `json:"changed_at" db:"changed_at"`
+	Snapshot   string         `json:"-" db:"snapshot"` // JSON encoded Expense
+	Changes    []FieldChange  `json:"changes"`
+	Expense    *Expense       `json:"expense"`
+}
+
+// FieldChange is a single field that differs between two revisions. Fields
+// of shares and payers are prefixed with the user they belong to, for
+// example "shares[2].share_amount", and fields of items with their position.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// DiffExpenses lists the fields that differ between two versions of an
+// expense. A nil before lists every field that is set in after.
+func DiffExpenses(before, after *Expense) []FieldChange {
+	changes := diffFields("", before, after)
+	if before == nil {
+		before = &Expense{}
+	}
+
+	beforeShares, afterShares := sharesByUser(before.Shares), sharesByUser(after.Shares)
+	for _, userID := range sortedUserIDs(beforeShares, afterShares) {
+		prefix := fmt.Sprintf("shares[%d].", userID)
+		changes = append(changes, diffFields(prefix, beforeShares[userID], afterShares[userID])...)
+	}
+
+	beforePayers, afterPayers := payersByUser(before.Payers), payersByUser(after.Payers)
+	for _, userID := range sortedUserIDs(beforePayers, afterPayers) {
+		prefix := fmt.Sprintf("payers[%d].", userID)
+		changes = append(changes, diffFields(prefix, beforePayers[userID], afterPayers[userID])...)
+	}
+
+	// Items are stored again on every update, so they are matched by position
+	for i := 0; i < len(before.Items) || i < len(after.Items); i++ {
+		var old, new *ExpenseItem
+		if i < len(before.Items) {
+			old = &before.Items[i]
+		}
+		if i < len(after.Items) {
+			new = &after.Items[i]
+		}
+		changes = append(changes, diffFields(fmt.Sprintf("items[%d].", i), old, new)...)
+	}
+
+	return changes
+}
+
+// diffFields compares the fields of two pointers to the same struct type.
+// Either may be nil when the record was added or removed, in which case the
+// zero fields of the other side are left out. Keys that identify the record
+// are skipped.
+func diffFields(prefix string, before, after interface{}) []FieldChange {
+	old, new := reflect.ValueOf(before), reflect.ValueOf(after)
+	t := old.Type().Elem()
+
+	var changes []FieldChange
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "expense_id" || name == "user_id" || name == "item_id" {
+			continue
+		}
+		// Nested records are compared by DiffExpenses itself
+		if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct {
+			continue
+		}
+
+		oldValue, oldZero := fieldValue(old, i)
+		newValue, newZero := fieldValue(new, i)
+		if reflect.DeepEqual(oldValue, newValue) || (oldValue == nil && newZero) || (newValue == nil && oldZero) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: prefix + name, Old: oldValue, New: newValue})
+	}
+	return changes
+}
+
+// fieldValue returns the i-th field of the struct v points to and whether it
+// is the zero value. A nil v has no value at all.
+func fieldValue(v reflect.Value, i int) (interface{}, bool) {
+	if v.IsNil() {
+		return nil, true
+	}
+	field := v.Elem().Field(i)
+	return field.Interface(), field.IsZero()
+}
+
+func sharesByUser(shares []Share) map[int]*Share {
+	byUser := make(map[int]*Share, len(shares))
+	for i := range shares {
+		byUser[shares[i].UserID] = &shares[i]
+	}
+	return byUser
+}
+
+func payersByUser(payers []Payer) map[int]*Payer {
+	byUser := make(map[int]*Payer, len(payers))
+	for i := range payers {
+		byUser[payers[i].UserID] = &payers[i]
+	}
+	return byUser
+}
+
+// sortedUserIDs returns the users present in either version in ascending
+// order.
+func sortedUserIDs(before, after interface{}) []int {
+	seen := make(map[int]bool)
+	for _, m := range []interface{}{before, after} {
+		for _, key := range reflect.ValueOf(m).MapKeys() {
+			seen[int(key.Int())] = true
+		}
+	}
+
+	ids := make([]int, 0, len(seen))
+	for userID := range seen {
+		ids = append(ids, userID)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"expense-sharing-api/pkg/money"
+	"reflect"
+	"testing"
+)
+
+func TestDiffExpenses(t *testing.T) {
+	dinner := func(change func(e *Expense)) *Expense {
+		e := &Expense{
+			ExpenseID:   1,
+			GroupID:     1,
+			Description: "Dinner",
+			Amount:      6000,
+			CreatedBy:   1,
+			SplitType:   SplitEqual,
+			Shares: []Share{
+				{ExpenseID: 1, UserID: 1, ShareAmount: 3000, PaidAmount: 6000},
+				{ExpenseID: 1, UserID: 2, ShareAmount: 3000},
+			},
+			Payers: []Payer{{ExpenseID: 1, UserID: 1, Amount: 6000}},
+		}
+		if change != nil {
+			change(e)
+		}
+		return e
+	}
+
+	tests := []struct {
+		name          string
+		before, after *Expense
+		want          []FieldChange
+	}{
+		{
+			name:   "no changes",
+			before: dinner(nil),
+			after:  dinner(nil),
+			want:   nil,
+		},
+		{
+			name:   "expense fields in declaration order",
+			before: dinner(nil),
+			after: dinner(func(e *Expense) {
+				e.SplitType = SplitExact
+				e.Description = "Team dinner"
+			}),
+			want: []FieldChange{
+				{Field: "description", Old: "Dinner", New: "Team dinner"},
+				{Field: "split_type", Old: SplitEqual, New: SplitExact},
+			},
+		},
+		{
+			name:   "shares are matched by user",
+			before: dinner(nil),
+			after: dinner(func(e *Expense) {
+				e.Shares = []Share{
+					{ExpenseID: 1, UserID: 3, ShareAmount: 2000},
+					{ExpenseID: 1, UserID: 2, ShareAmount: 2000},
+					{ExpenseID: 1, UserID: 1, ShareAmount: 2000, PaidAmount: 6000},
+				}
+			}),
+			want: []FieldChange{
+				{Field: "shares[1].share_amount", Old: money.Money(3000), New: money.Money(2000)},
+				{Field: "shares[2].share_amount", Old: money.Money(3000), New: money.Money(2000)},
+				{Field: "shares[3].share_amount", Old: nil, New: money.Money(2000)},
+			},
+		},
+		{
+			name:   "removed payers and shares",
+			before: dinner(nil),
+			after: dinner(func(e *Expense) {
+				e.Shares = e.Shares[:1]
+				e.Payers = []Payer{{ExpenseID: 1, UserID: 2, Amount: 6000}}
+			}),
+			want: []FieldChange{
+				{Field: "shares[2].share_amount", Old: money.Money(3000), New: nil},
+				{Field: "payers[1].amount", Old: money.Money(6000), New: nil},
+				{Field: "payers[2].amount", Old: nil, New: money.Money(6000)},
+			},
+		},
+		{
+			name: "items are matched by position",
+			before: dinner(func(e *Expense) {
+				e.Items = []ExpenseItem{{ItemID: 1, Description: "Pizza", Price: 6000, Participants: []int{1, 2}}}
+			}),
+			after: dinner(func(e *Expense) {
+				e.Items = []ExpenseItem{
+					{ItemID: 2, Description: "Pizza", Price: 4000, Participants: []int{1, 2}},
+					{ItemID: 3, Description: "Wine", Price: 2000, Participants: []int{1}},
+				}
+			}),
+			want: []FieldChange{
+				{Field: "items[0].price", Old: money.Money(6000), New: money.Money(4000)},
+				{Field: "items[1].description", Old: nil, New: "Wine"},
+				{Field: "items[1].price", Old: nil, New: money.Money(2000)},
+				{Field: "items[1].participants", Old: nil, New: []int{1}},
+			},
+		},
+		{
+			name:   "a new expense lists every field that is set",
+			before: nil,
+			after: &Expense{
+				ExpenseID:   1,
+				Description: "Taxi",
+				Amount:      1500,
+				Shares:      []Share{{ExpenseID: 1, UserID: 2, ShareAmount: 1500}},
+			},
+			want: []FieldChange{
+				{Field: "description", Old: nil, New: "Taxi"},
+				{Field: "amount", Old: nil, New: money.Money(1500)},
+				{Field: "shares[2].share_amount", Old: nil, New: money.Money(1500)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DiffExpenses(tt.before, tt.after)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffExpenses() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+// Role is what a member may do within a group.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleViewer Role = "viewer"
+)
+
+type Permission int
+
+const (
+	PermWrite              Permission = iota // Add expenses, edit own expenses and record settlements
+	PermEditOthersExpenses                   // Edit, delete and restore expenses created by others
+	PermManageMembers                        // Add and remove members and change their roles
+	PermEditGroup                            // Rename the group and change its settings
+	PermTransferOwnership                    // Hand the group over to another member
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner:  {PermWrite, PermEditOthersExpenses, PermManageMembers, PermEditGroup, PermTransferOwnership},
+	RoleAdmin:  {PermWrite, PermEditOthersExpenses, PermManageMembers, PermEditGroup},
+	RoleMember: {PermWrite},
+	RoleViewer: {},
+}
+
+// rank orders the roles from least to most powerful.
+var rank = map[Role]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+func (r Role) Valid() bool {
+	_, ok := rank[r]
+	return ok
+}
+
+// Can reports whether members with this role have the permission.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Outranks reports whether r is more powerful than other. Members can only
+// manage members, and hand out roles, below their own.
+func (r Role) Outranks(other Role) bool {
+	return rank[r] > rank[other]
+}
@@ -1,19 +1,62 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"expense-sharing-api/pkg/money"
+	"expense-sharing-api/pkg/settle"
+	"time"
+)
 
 type Settlement struct {
-	SettlementID int       `json:"settlement_id" db:"settlement_id"`
-	PayerID      int       `json:"payer_id" db:"payer_id"`
-	PayeeID      int       `json:"payee_id" db:"payee_id"`
-	Amount       float64   `json:"amount" db:"amount"`
-	GroupID      int       `json:"group_id" db:"group_id"`
-	SettledAt    time.Time `json:"settled_at" db:"settled_at"`
-	Notes        string    `json:"notes" db:"notes"`
+	SettlementID int         `json:"settlement_id" db:"settlement_id"`
+	PayerID      int         `json:"payer_id" db:"payer_id"`
+	PayeeID      int         `json:"payee_id" db:"payee_id"`
+	Amount       money.Money `json:"amount" db:"amount"`
+	GroupID      int         `json:"group_id" db:"group_id"`
+	SettledAt    time.Time   `json:"settled_at" db:"settled_at"`
+	Notes        string      `json:"notes" db:"notes"`
+	WriteOff     bool        `json:"write_off" db:"write_off"` // Recorded on removal, no money changed hands
+}
+
+type SettlementCreate struct {
+	PayerID int         `json:"payer_id"`
+	PayeeID int         `json:"payee_id"`
+	Amount  money.Money `json:"amount"`
+	Notes   string      `json:"notes"`
+}
+
+func (s *SettlementCreate) Validate() error {
+	if s.PayerID == 0 {
+		return errors.New("payer ID is required")
+	}
+	if s.PayeeID == 0 {
+		return errors.New("payee ID is required")
+	}
+	if s.PayerID == s.PayeeID {
+		return errors.New("payer and payee must be different users")
+	}
+	if s.Amount <= 0 {
+		return errors.New("amount must be greater than 0")
+	}
+	return nil
 }
 
 type Balance struct {
-	UserID int     `db:"user_id" json:"user_id"`
-	OwedTo int     `db:"owed_to" json:"owed_to"`
-	Amount float64 `db:"amount" json:"amount"`
+	UserID int         `db:"user_id" json:"user_id"`
+	OwedTo int         `db:"owed_to" json:"owed_to"`
+	Amount money.Money `db:"amount" json:"amount"`
+}
+
+// NetBalance is a member's overall position in a group. A positive amount
+// means the member is owed money, a negative amount means they owe money.
+type NetBalance struct {
+	UserID int         `db:"user_id" json:"user_id"`
+	Amount money.Money `db:"amount" json:"amount"`
+}
+
+type SettlePlan struct {
+	GroupID   int               `json:"group_id"`
+	Currency  string            `json:"currency"` // The group's currency, all amounts are in it
+	Balances  []NetBalance      `json:"balances"`
+	Transfers []settle.Transfer `json:"transfers"`
 }
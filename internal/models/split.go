@@ -0,0 +1,163 @@
+package models
+
+import (
+	"expense-sharing-api/pkg/money"
+	"math"
+	"sort"
+)
+
+// CalculateShares fills in the authoritative ShareAmount of every
+// participant from the inputs of the split type, and mirrors the payers on
+// the shares' PaidAmount. It must be called after ResolvePayers. Minor units
+// that cannot be divided evenly are handed out to the payer first and then to
+// the other participants in order of user ID, so the same input always
+// produces the same shares.
+func (e *ExpenseCreate) CalculateShares() {
+	defer e.syncPaidAmounts()
+
+	if e.SplitType == SplitItemized {
+		e.calculateItemizedShares(e.payerID())
+		return
+	}
+
+	weights := make([]int64, len(e.Shares))
+	total := e.Amount
+	switch e.SplitType {
+	case SplitEqual:
+		for i := range e.Shares {
+			weights[i] = 1
+		}
+	case SplitAdjustment:
+		// Whatever the adjustments leave over is divided equally
+		for i, share := range e.Shares {
+			weights[i] = 1
+			total -= share.Adjustment
+		}
+	case SplitPercentage:
+		for i, share := range e.Shares {
+			weights[i] = hundredths(share.SharePercentage)
+		}
+	case SplitShares:
+		for i, share := range e.Shares {
+			weights[i] = int64(share.ShareUnits)
+		}
+	default:
+		// EXACT shares are the client's input and were checked by Validate
+		return
+	}
+
+	order := e.allocationOrder(e.payerID())
+	ordered := make([]int64, len(order))
+	for i, idx := range order {
+		ordered[i] = weights[idx]
+	}
+	parts := total.Allocate(ordered)
+	for i, idx := range order {
+		e.Shares[idx].ShareAmount = parts[i] + e.Shares[idx].Adjustment
+	}
+}
+
+// calculateItemizedShares divides each item between its participants and
+// then shares tax, tip and service charge in proportion to the resulting
+// subtotals. Every item participant gets a share, even if the client only
+// sent the payers.
+func (e *ExpenseCreate) calculateItemizedShares(payerID int) {
+	subtotals := make(map[int]money.Money)
+	for _, item := range e.Items {
+		participants := payerFirst(item.Participants, payerID)
+		parts := item.Price.Split(len(participants))
+		for i, userID := range participants {
+			subtotals[userID] += parts[i]
+		}
+	}
+
+	known := make(map[int]bool, len(e.Shares))
+	for _, share := range e.Shares {
+		known[share.UserID] = true
+	}
+	for _, userID := range payerFirst(keys(subtotals), payerID) {
+		if !known[userID] {
+			e.Shares = append(e.Shares, ShareCreate{UserID: userID})
+		}
+	}
+
+	order := e.allocationOrder(payerID)
+	weights := make([]int64, len(order))
+	for i, idx := range order {
+		weights[i] = subtotals[e.Shares[idx].UserID].Minor()
+	}
+	extras := e.extras().Allocate(weights)
+	for i, idx := range order {
+		e.Shares[idx].ShareAmount = subtotals[e.Shares[idx].UserID] + extras[i]
+	}
+}
+
+// hundredths converts a percentage with two decimal places to an integer so
+// percentages can be added and compared exactly.
+func hundredths(percentage float64) int64 {
+	return int64(math.Round(percentage * 100))
+}
+
+// payerID returns the member who paid the most towards the expense, the
+// lowest user ID winning ties.
+func (e *ExpenseCreate) payerID() int {
+	var payerID int
+	var paid money.Money
+	for _, payer := range e.Payers {
+		if payer.Amount > paid || (payer.Amount == paid && payer.UserID < payerID) {
+			payerID = payer.UserID
+			paid = payer.Amount
+		}
+	}
+	return payerID
+}
+
+// syncPaidAmounts copies each participant's payment onto their share so
+// paid_amount stays consistent with the payers.
+func (e *ExpenseCreate) syncPaidAmounts() {
+	paid := make(map[int]money.Money, len(e.Payers))
+	for _, payer := range e.Payers {
+		paid[payer.UserID] += payer.Amount
+	}
+	for i := range e.Shares {
+		e.Shares[i].PaidAmount = paid[e.Shares[i].UserID]
+	}
+}
+
+// allocationOrder returns the indexes of the shares with the payer first and
+// everyone else sorted by user ID.
+func (e *ExpenseCreate) allocationOrder(payerID int) []int {
+	order := make([]int, len(e.Shares))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := e.Shares[order[i]], e.Shares[order[j]]
+		if (a.UserID == payerID) != (b.UserID == payerID) {
+			return a.UserID == payerID
+		}
+		return a.UserID < b.UserID
+	})
+	return order
+}
+
+// payerFirst returns a sorted copy of the user IDs with the payer moved to
+// the front.
+func payerFirst(userIDs []int, payerID int) []int {
+	sorted := append([]int(nil), userIDs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if (sorted[i] == payerID) != (sorted[j] == payerID) {
+			return sorted[i] == payerID
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
+
+func keys(m map[int]money.Money) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"expense-sharing-api/pkg/money"
+	"reflect"
+	"testing"
+)
+
+func TestCalculateShares(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     ExpenseCreate
+		createdBy int
+		want      map[int]money.Money
+	}{
+		{
+			name: "equal split without remainder",
+			input: ExpenseCreate{Amount: 9000, SplitType: SplitEqual, Shares: []ShareCreate{
+				{UserID: 1}, {UserID: 2}, {UserID: 3},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 3000, 2: 3000, 3: 3000},
+		},
+		{
+			name: "equal remainder goes to the payer first",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitEqual, Shares: []ShareCreate{
+				{UserID: 1}, {UserID: 2, PaidAmount: 1000}, {UserID: 3},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 333, 2: 334, 3: 333},
+		},
+		{
+			name: "creator counts as payer when nobody paid",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitEqual, Shares: []ShareCreate{
+				{UserID: 1}, {UserID: 2}, {UserID: 3},
+			}},
+			createdBy: 3,
+			want:      map[int]money.Money{1: 333, 2: 333, 3: 334},
+		},
+		{
+			name: "explicit payers, the one who paid most goes first",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitEqual,
+				Shares: []ShareCreate{{UserID: 1}, {UserID: 2}, {UserID: 3}},
+				Payers: []PayerCreate{{UserID: 2, Amount: 400}, {UserID: 3, Amount: 600}},
+			},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 333, 2: 333, 3: 334},
+		},
+		{
+			name: "equal remainder then follows user ID, not share order",
+			input: ExpenseCreate{Amount: 1001, SplitType: SplitEqual, Shares: []ShareCreate{
+				{UserID: 4}, {UserID: 3}, {UserID: 2, PaidAmount: 501}, {UserID: 1, PaidAmount: 500},
+			}},
+			createdBy: 4,
+			want:      map[int]money.Money{1: 250, 2: 251, 3: 250, 4: 250},
+		},
+		{
+			name: "tied payers, the lowest user ID is the payer",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitEqual, Shares: []ShareCreate{
+				{UserID: 3, PaidAmount: 500}, {UserID: 2, PaidAmount: 500}, {UserID: 1},
+			}},
+			createdBy: 3,
+			want:      map[int]money.Money{1: 333, 2: 334, 3: 333},
+		},
+		{
+			name: "percentages",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitPercentage, Shares: []ShareCreate{
+				{UserID: 1, SharePercentage: 33.33}, {UserID: 2, SharePercentage: 33.33}, {UserID: 3, SharePercentage: 33.34},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 333, 2: 333, 3: 334},
+		},
+		{
+			name: "percentage remainder ties go to the payer",
+			input: ExpenseCreate{Amount: 1001, SplitType: SplitPercentage, Shares: []ShareCreate{
+				{UserID: 1, SharePercentage: 50}, {UserID: 2, SharePercentage: 50, PaidAmount: 1001},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 500, 2: 501},
+		},
+		{
+			name: "client share amounts are overwritten",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitPercentage, Shares: []ShareCreate{
+				{UserID: 1, SharePercentage: 25, ShareAmount: 900}, {UserID: 2, SharePercentage: 75, ShareAmount: 100},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 250, 2: 750},
+		},
+		{
+			name: "share units",
+			input: ExpenseCreate{Amount: 9000, SplitType: SplitShares, Shares: []ShareCreate{
+				{UserID: 1, ShareUnits: 2}, {UserID: 2, ShareUnits: 1},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 6000, 2: 3000},
+		},
+		{
+			name: "share unit remainder goes by largest fraction",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitShares, Shares: []ShareCreate{
+				{UserID: 1, ShareUnits: 1}, {UserID: 2, ShareUnits: 2},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 333, 2: 667},
+		},
+		{
+			name: "adjustments come on top of an equal split",
+			input: ExpenseCreate{Amount: 9000, SplitType: SplitAdjustment, Shares: []ShareCreate{
+				{UserID: 1, Adjustment: 1000}, {UserID: 2}, {UserID: 3},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 3667, 2: 2667, 3: 2666},
+		},
+		{
+			name: "negative adjustments",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitAdjustment, Shares: []ShareCreate{
+				{UserID: 1, Adjustment: -200}, {UserID: 2},
+			}},
+			createdBy: 2,
+			want:      map[int]money.Money{1: 400, 2: 600},
+		},
+		{
+			name: "items are split between their participants, extras by subtotal",
+			input: ExpenseCreate{Amount: 9000, SplitType: SplitItemized, Tax: 300, Tip: 200,
+				Shares: []ShareCreate{{UserID: 1, PaidAmount: 9000}},
+				Items: []ItemCreate{
+					{Description: "Pizza", Price: 5000, Participants: []int{3, 2, 1}},
+					{Description: "Wine", Price: 3500, Participants: []int{1, 2}},
+				},
+			},
+			createdBy: 2,
+			want:      map[int]money.Money{1: 3618, 2: 3618, 3: 1764},
+		},
+		{
+			name: "itemized remainders go to the payer first",
+			input: ExpenseCreate{Amount: 1001, SplitType: SplitItemized, ServiceCharge: 1,
+				Shares: []ShareCreate{{UserID: 2, PaidAmount: 1001}},
+				Items:  []ItemCreate{{Description: "Fries", Price: 1000, Participants: []int{1, 2, 3}}},
+			},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 333, 2: 335, 3: 333},
+		},
+		{
+			name: "exact shares are left alone",
+			input: ExpenseCreate{Amount: 1000, SplitType: SplitExact, Shares: []ShareCreate{
+				{UserID: 1, ShareAmount: 700}, {UserID: 2, ShareAmount: 300},
+			}},
+			createdBy: 1,
+			want:      map[int]money.Money{1: 700, 2: 300},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := tt.input
+			input.ResolvePayers(tt.createdBy)
+			input.CalculateShares()
+
+			got := make(map[int]money.Money, len(input.Shares))
+			for _, share := range input.Shares {
+				got[share.UserID] = share.ShareAmount
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CalculateShares() shares = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"time"
 )
 
+// User is a registered account or, if IsGuest is set, a named placeholder
+// for someone who splits expenses without an account. Guests have no email
+// address or password and cannot log in.
 type User struct {
 	UserID       int       `json:"user_id" db:"user_id"`
-	Email        string    `json:"email" db:"email"`
+	Email        *string   `json:"email,omitempty" db:"email"`
 	FullName     string    `json:"full_name" db:"full_name"`
-	PasswordHash string    `json:"-" db:"password_hash"`
+	PasswordHash *string   `json:"-" db:"password_hash"`
+	IsGuest      bool      `json:"is_guest" db:"is_guest"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
@@ -20,9 +24,10 @@ type UserLogin struct {
 }
 
 type UserRegister struct {
-	Email    string `json:"email"`
-	FullName string `json:"full_name"`
-	Password string `json:"password"`
+	Email       string `json:"email"`
+	FullName    string `json:"full_name"`
+	Password    string `json:"password"`
+	InviteToken string `json:"invite_token,omitempty"` // Joins the group the token invites to
 }
 
 func (u *UserRegister) Validate() error {
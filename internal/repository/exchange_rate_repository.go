@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"expense-sharing-api/pkg/rates"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type ExchangeRateRepository struct {
+	db *sqlx.DB
+}
+
+func NewExchangeRateRepository(db *sqlx.DB) *ExchangeRateRepository {
+	return &ExchangeRateRepository{db: db}
+}
+
+// Import stores the rates, replacing any already stored for the same day and
+// currency pair, and returns how many were written.
+func (r *ExchangeRateRepository) Import(imported []rates.Rate) (int, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+        INSERT INTO exchange_rates (base_currency, quote_currency, rate_date, rate)
+        VALUES (?, ?, ?, ?)
+        ON CONFLICT (base_currency, quote_currency, rate_date)
+        DO UPDATE SET rate = excluded.rate, imported_at = CURRENT_TIMESTAMP`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	for _, rate := range imported {
+		// Dates are stored as plain text so they compare in calendar order
+		if _, err := stmt.Exec(rate.Base, rate.Quote, rate.Date.Format(rates.DateLayout), rate.Value); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(imported), tx.Commit()
+}
+
+// Lookup finds the rate from one currency to another on the given day, or on
+// the closest earlier day that has one. Besides the pair itself it uses the
+// inverse pair and, for files like the ECB's that quote everything against
+// one currency, the cross rate through that currency. The most recent day
+// wins, with direct rates preferred over cross rates on the same day. It
+// returns nil if no rate is on file.
+func (r *ExchangeRateRepository) Lookup(from, to string, on time.Time) (*rates.Rate, error) {
+	query := `
+        SELECT rate_date, rate FROM (
+            SELECT rate_date, rate, 0 AS hops
+            FROM exchange_rates
+            WHERE base_currency = ? AND quote_currency = ? AND rate_date <= ?
+            UNION ALL
+            SELECT rate_date, 1.0 / rate, 0
+            FROM exchange_rates
+            WHERE base_currency = ? AND quote_currency = ? AND rate_date <= ?
+            UNION ALL
+            SELECT a.rate_date, b.rate / a.rate, 1
+            FROM exchange_rates a
+            JOIN exchange_rates b
+                ON b.base_currency = a.base_currency AND b.rate_date = a.rate_date
+            WHERE a.quote_currency = ? AND b.quote_currency = ? AND a.rate_date <= ?
+        )
+        ORDER BY rate_date DESC, hops
+        LIMIT 1`
+
+	day := on.Format(rates.DateLayout)
+	rate := rates.Rate{Base: from, Quote: to}
+	err := r.db.QueryRowx(query,
+		from, to, day,
+		to, from, day,
+		from, to, day,
+	).Scan(&rate.Date, &rate.Value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"expense-sharing-api/internal/config"
+	"expense-sharing-api/pkg/rates"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func day(value string) time.Time {
+	date, err := time.Parse(rates.DateLayout, value)
+	if err != nil {
+		panic(err)
+	}
+	return date
+}
+
+// newTestDB returns an empty database with the current schema, removed
+// again when the test ends.
+func newTestDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dbConfig := &config.DBConfig{DBPath: filepath.Join(t.TempDir(), "test.db")}
+	db, err := dbConfig.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := dbConfig.InitSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newExchangeRateRepository(t *testing.T) *ExchangeRateRepository {
+	return NewExchangeRateRepository(newTestDB(t))
+}
+
+func TestExchangeRateLookup(t *testing.T) {
+	repo := newExchangeRateRepository(t)
+	imported := []rates.Rate{
+		{Date: day("2024-01-01"), Base: "USD", Quote: "GBP", Value: 0.8},
+		{Date: day("2024-01-02"), Base: "EUR", Quote: "USD", Value: 1.1},
+		{Date: day("2024-01-02"), Base: "EUR", Quote: "GBP", Value: 0.86},
+		{Date: day("2024-01-03"), Base: "EUR", Quote: "USD", Value: 1.25},
+		{Date: day("2024-01-03"), Base: "EUR", Quote: "JPY", Value: 155},
+		{Date: day("2024-01-03"), Base: "EUR", Quote: "CHF", Value: 0.93},
+		{Date: day("2024-01-03"), Base: "USD", Quote: "CHF", Value: 0.85},
+	}
+	if _, err := repo.Import(imported); err != nil {
+		t.Fatalf("Import returned error %v", err)
+	}
+	// Divide at run time, like the database does, not as exact constants
+	div := func(a, b float64) float64 { return a / b }
+
+	tests := []struct {
+		name     string
+		from, to string
+		on       string
+		wantDate string
+		want     float64
+	}{
+		{"direct", "EUR", "USD", "2024-01-03", "2024-01-03", 1.25},
+		{"direct on an earlier day", "EUR", "USD", "2024-01-02", "2024-01-02", 1.1},
+		{"closest earlier day", "EUR", "USD", "2024-01-06", "2024-01-03", 1.25},
+		{"inverse", "USD", "EUR", "2024-01-03", "2024-01-03", div(1, 1.25)},
+		{"cross through the shared base", "USD", "JPY", "2024-01-03", "2024-01-03", div(155, 1.25)},
+		{"newer cross rate beats older direct rate", "USD", "GBP", "2024-01-05", "2024-01-02", div(0.86, 1.1)},
+		{"direct rate beats cross rate on the same day", "USD", "CHF", "2024-01-03", "2024-01-03", 0.85},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := repo.Lookup(tt.from, tt.to, day(tt.on))
+			if err != nil {
+				t.Fatalf("Lookup returned error %v", err)
+			}
+			if rate == nil {
+				t.Fatalf("Lookup(%s, %s, %s) found no rate", tt.from, tt.to, tt.on)
+			}
+			if rate.Base != tt.from || rate.Quote != tt.to || rate.Date.Format(rates.DateLayout) != tt.wantDate || rate.Value != tt.want {
+				t.Errorf("Lookup(%s, %s, %s) = %s %s/%s %v, want %s %s/%s %v", tt.from, tt.to, tt.on,
+					rate.Date.Format(rates.DateLayout), rate.Base, rate.Quote, rate.Value, tt.wantDate, tt.from, tt.to, tt.want)
+			}
+		})
+	}
+
+	for _, missing := range []struct{ from, to, on string }{
+		{"EUR", "USD", "2023-12-31"},
+		{"USD", "AUD", "2024-01-03"},
+	} {
+		rate, err := repo.Lookup(missing.from, missing.to, day(missing.on))
+		if err != nil || rate != nil {
+			t.Errorf("Lookup(%s, %s, %s) = %+v, %v, want no rate", missing.from, missing.to, missing.on, rate, err)
+		}
+	}
+}
+
+func TestExchangeRateImportReplaces(t *testing.T) {
+	repo := newExchangeRateRepository(t)
+	for _, value := range []float64{1.1, 1.2} {
+		if _, err := repo.Import([]rates.Rate{{Date: day("2024-01-02"), Base: "EUR", Quote: "USD", Value: value}}); err != nil {
+			t.Fatalf("Import returned error %v", err)
+		}
+	}
+
+	rate, err := repo.Lookup("EUR", "USD", day("2024-01-02"))
+	if err != nil || rate == nil || rate.Value != 1.2 {
+		t.Errorf("Lookup after re-import = %+v, %v, want the rate 1.2", rate, err)
+	}
+}
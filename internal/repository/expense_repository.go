@@ -1,9 +1,13 @@
 package repository
 
 import (
+	"encoding/json"
 	"expense-sharing-api/internal/models"
+	"expense-sharing-api/pkg/settle"
 	"fmt"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -16,7 +20,16 @@ func NewExpenseRepository(db *sqlx.DB) *ExpenseRepository {
 	return &ExpenseRepository{db: db}
 }
 
+// Create stores a validated expense. Share amounts sent by the client are
+// replaced with the server's own calculation before anything is written.
 func (r *ExpenseRepository) Create(expense *models.ExpenseCreate, createdBy int) (*models.Expense, error) {
+	expense.ResolvePayers(createdBy)
+	expense.CalculateShares()
+	baseAmount, err := expense.Amount.Convert(expense.ExchangeRate)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := r.db.Beginx()
 	if err != nil {
 		return nil, err
@@ -25,9 +38,11 @@ func (r *ExpenseRepository) Create(expense *models.ExpenseCreate, createdBy int)
 
 	// Create expense
 	expenseQuery := `
-        INSERT INTO expenses (group_id, description, amount, created_by, split_type)
-        VALUES (?, ?, ?, ?, ?)
-        RETURNING expense_id, group_id, description, amount, created_by, split_type, created_at`
+        INSERT INTO expenses (group_id, description, amount, created_by, split_type, tax, tip, service_charge,
+            currency, exchange_rate, base_amount, expense_date)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        RETURNING expense_id, group_id, description, amount, created_by, split_type, created_at,
+            tax, tip, service_charge, currency, exchange_rate, base_amount, expense_date`
 
 	var created models.Expense
 	err = tx.QueryRowx(expenseQuery,
@@ -36,49 +51,396 @@ func (r *ExpenseRepository) Create(expense *models.ExpenseCreate, createdBy int)
 		expense.Amount,
 		createdBy,
 		expense.SplitType,
+		expense.Tax,
+		expense.Tip,
+		expense.ServiceCharge,
+		expense.Currency,
+		expense.ExchangeRate,
+		baseAmount,
+		expense.ExpenseDate,
 	).StructScan(&created)
 	if err != nil {
 		return nil, err
 	}
 
-	// Add shares
-	shareQuery := `
-        INSERT INTO expense_shares (expense_id, user_id, share_amount, share_percentage, paid_amount)
-        VALUES (?, ?, ?, ?, ?)`
+	created.Shares, err = insertShares(tx, created.ExpenseID, expense.Shares)
+	if err != nil {
+		return nil, err
+	}
+
+	created.Payers, err = insertPayers(tx, created.ExpenseID, expense.Payers)
+	if err != nil {
+		return nil, err
+	}
+
+	created.Items, err = insertItems(tx, created.ExpenseID, expense.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordRevision(tx, &created, models.RevisionCreate, createdBy); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &created, nil
+}
+
+// Update replaces an expense and everything derived from it in a single
+// transaction. Shares are recalculated exactly as on Create, with any
+// unpaid remainder attributed to the original creator. If nothing changes,
+// nothing is written and the stored expense is returned.
+func (r *ExpenseRepository) Update(expenseID int, expense *models.ExpenseCreate, createdBy, changedBy int) (*models.Expense, error) {
+	expense.ResolvePayers(createdBy)
+	expense.CalculateShares()
+	baseAmount, err := expense.Amount.Convert(expense.ExchangeRate)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := recordBaseline(tx, expenseID); err != nil {
+		return nil, err
+	}
+	previous, err := getExpense(tx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        UPDATE expenses
+        SET description = ?, amount = ?, split_type = ?, tax = ?, tip = ?, service_charge = ?,
+            currency = ?, exchange_rate = ?, base_amount = ?, expense_date = ?
+        WHERE expense_id = ?
+        RETURNING *`
+
+	var updated models.Expense
+	err = tx.QueryRowx(query,
+		expense.Description,
+		expense.Amount,
+		expense.SplitType,
+		expense.Tax,
+		expense.Tip,
+		expense.ServiceCharge,
+		expense.Currency,
+		expense.ExchangeRate,
+		baseAmount,
+		expense.ExpenseDate,
+		expenseID,
+	).StructScan(&updated)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := deleteDetails(tx, expenseID); err != nil {
+		return nil, err
+	}
+
+	updated.Shares, err = insertShares(tx, expenseID, expense.Shares)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Payers, err = insertPayers(tx, expenseID, expense.Payers)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, share := range expense.Shares {
-		_, err = tx.Exec(shareQuery,
-			created.ExpenseID,
+	updated.Items, err = insertItems(tx, expenseID, expense.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	// An edit that leaves everything as it was is rolled back, so it neither
+	// touches the expense nor shows up in its history
+	if len(models.DiffExpenses(previous, &updated)) == 0 {
+		return previous, nil
+	}
+
+	if err := recordRevision(tx, &updated, models.RevisionUpdate, changedBy); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// Delete moves an expense to the group's trash. It no longer counts towards
+// balances but can be restored until it is purged.
+func (r *ExpenseRepository) Delete(expenseID, changedBy int) error {
+	query := `UPDATE expenses SET deleted_at = CURRENT_TIMESTAMP WHERE expense_id = ? AND deleted_at IS NULL`
+	_, err := r.setDeleted(expenseID, query, models.RevisionDelete, changedBy)
+	return err
+}
+
+func (r *ExpenseRepository) Restore(expenseID, changedBy int) (*models.Expense, error) {
+	query := `UPDATE expenses SET deleted_at = NULL WHERE expense_id = ?`
+	return r.setDeleted(expenseID, query, models.RevisionRestore, changedBy)
+}
+
+// setDeleted runs a query that moves an expense in or out of the trash and
+// records the revision it creates.
+func (r *ExpenseRepository) setDeleted(expenseID int, query string, action models.RevisionAction, changedBy int) (*models.Expense, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := recordBaseline(tx, expenseID); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(query, expenseID); err != nil {
+		return nil, err
+	}
+
+	expense, err := getExpense(tx, expenseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordRevision(tx, expense, action, changedBy); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return expense, nil
+}
+
+// GetHistory returns the revisions of an expense, oldest first, each with
+// the fields that changed since the revision before it.
+func (r *ExpenseRepository) GetHistory(expenseID int) ([]models.ExpenseRevision, error) {
+	query := `SELECT * FROM expense_revisions WHERE expense_id = ? ORDER BY revision_id`
+	var revisions []models.ExpenseRevision
+	err := r.db.Select(&revisions, query, expenseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *models.Expense
+	for i := range revisions {
+		var expense models.Expense
+		if err := json.Unmarshal([]byte(revisions[i].Snapshot), &expense); err != nil {
+			return nil, fmt.Errorf("error decoding revision %d: %v", revisions[i].RevisionID, err)
+		}
+		revisions[i].Expense = &expense
+		revisions[i].Changes = models.DiffExpenses(previous, &expense)
+		previous = &expense
+	}
+
+	return revisions, nil
+}
+
+// recordRevision stores a snapshot of an expense as it is after a change,
+// in the transaction that made the change.
+func recordRevision(tx *sqlx.Tx, expense *models.Expense, action models.RevisionAction, changedBy int) error {
+	snapshot, err := json.Marshal(expense)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO expense_revisions (expense_id, action, changed_by, snapshot) VALUES (?, ?, ?, ?)`
+	_, err = tx.Exec(query, expense.ExpenseID, action, changedBy, string(snapshot))
+	return err
+}
+
+// recordBaseline stores the current state of an expense that was created
+// before revisions were kept as its CREATE revision, so the first recorded
+// change has something to be compared with.
+func recordBaseline(tx *sqlx.Tx, expenseID int) error {
+	var revisions int
+	err := tx.Get(&revisions, `SELECT COUNT(*) FROM expense_revisions WHERE expense_id = ?`, expenseID)
+	if err != nil || revisions > 0 {
+		return err
+	}
+
+	expense, err := getExpense(tx, expenseID)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(expense)
+	if err != nil {
+		return err
+	}
+
+	query := `
+        INSERT INTO expense_revisions (expense_id, action, changed_by, changed_at, snapshot)
+        SELECT expense_id, ?, created_by, created_at, ? FROM expenses WHERE expense_id = ?`
+	_, err = tx.Exec(query, models.RevisionCreate, string(snapshot), expenseID)
+	return err
+}
+
+func (r *ExpenseRepository) GetGroupTrash(groupID int) ([]models.Expense, error) {
+	query := `SELECT * FROM expenses WHERE group_id = ? AND deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	var expenses []models.Expense
+	err := r.db.Select(&expenses, query, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range expenses {
+		if err := loadDetails(r.db, &expenses[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return expenses, nil
+}
+
+// PurgeDeleted permanently removes expenses that have been in the trash for
+// longer than the retention period and returns how many were removed.
+func (r *ExpenseRepository) PurgeDeleted(retention time.Duration) (int, error) {
+	var expenseIDs []int
+	query := `SELECT expense_id FROM expenses WHERE deleted_at < datetime('now', ?)`
+	err := r.db.Select(&expenseIDs, query, fmt.Sprintf("-%d seconds", int64(retention.Seconds())))
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, expenseID := range expenseIDs {
+		if err := deleteDetails(tx, expenseID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`DELETE FROM expenses WHERE expense_id = ?`, expenseID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(expenseIDs), nil
+}
+
+// deleteDetails removes the shares, payers and items of an expense.
+func deleteDetails(tx *sqlx.Tx, expenseID int) error {
+	return execAll(tx, []string{
+		`DELETE FROM expense_shares WHERE expense_id = ?`,
+		`DELETE FROM expense_payers WHERE expense_id = ?`,
+		`DELETE FROM expense_item_participants
+         WHERE item_id IN (SELECT item_id FROM expense_items WHERE expense_id = ?)`,
+		`DELETE FROM expense_items WHERE expense_id = ?`,
+	}, expenseID)
+}
+
+func execAll(tx *sqlx.Tx, queries []string, args ...interface{}) error {
+	for _, query := range queries {
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertShares(tx *sqlx.Tx, expenseID int, shares []models.ShareCreate) ([]models.Share, error) {
+	query := `
+        INSERT INTO expense_shares (expense_id, user_id, share_amount, share_percentage, paid_amount, share_units, adjustment)
+        VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	var inserted []models.Share
+	for _, share := range shares {
+		_, err := tx.Exec(query,
+			expenseID,
 			share.UserID,
 			share.ShareAmount,
 			share.SharePercentage,
 			share.PaidAmount,
+			share.ShareUnits,
+			share.Adjustment,
 		)
 		if err != nil {
 			return nil, err
 		}
+		inserted = append(inserted, models.Share{
+			ExpenseID:       expenseID,
+			UserID:          share.UserID,
+			ShareAmount:     share.ShareAmount,
+			SharePercentage: share.SharePercentage,
+			PaidAmount:      share.PaidAmount,
+			ShareUnits:      share.ShareUnits,
+			Adjustment:      share.Adjustment,
+		})
 	}
+	return inserted, nil
+}
 
-	err = tx.Commit()
-	if err != nil {
-		return nil, err
+func insertPayers(tx *sqlx.Tx, expenseID int, payers []models.PayerCreate) ([]models.Payer, error) {
+	query := `INSERT INTO expense_payers (expense_id, user_id, amount) VALUES (?, ?, ?)`
+
+	var inserted []models.Payer
+	for _, payer := range payers {
+		if _, err := tx.Exec(query, expenseID, payer.UserID, payer.Amount); err != nil {
+			return nil, err
+		}
+		inserted = append(inserted, models.Payer{
+			ExpenseID: expenseID,
+			UserID:    payer.UserID,
+			Amount:    payer.Amount,
+		})
 	}
+	return inserted, nil
+}
 
-	return &created, nil
+func insertItems(tx *sqlx.Tx, expenseID int, items []models.ItemCreate) ([]models.ExpenseItem, error) {
+	itemQuery := `
+        INSERT INTO expense_items (expense_id, description, price)
+        VALUES (?, ?, ?)
+        RETURNING item_id, expense_id, description, price`
+	participantQuery := `INSERT INTO expense_item_participants (item_id, user_id) VALUES (?, ?)`
+
+	var inserted []models.ExpenseItem
+	for _, item := range items {
+		var created models.ExpenseItem
+		err := tx.QueryRowx(itemQuery, expenseID, item.Description, item.Price).StructScan(&created)
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range item.Participants {
+			if _, err := tx.Exec(participantQuery, created.ItemID, userID); err != nil {
+				return nil, err
+			}
+		}
+		created.Participants = item.Participants
+		inserted = append(inserted, created)
+	}
+	return inserted, nil
 }
 
 func (r *ExpenseRepository) GetByID(expenseID int) (*models.Expense, error) {
+	return getExpense(r.db, expenseID)
+}
+
+// getExpense loads an expense with its details through either the database
+// or an open transaction.
+func getExpense(q sqlx.Queryer, expenseID int) (*models.Expense, error) {
 	var expense models.Expense
 	query := `SELECT * FROM expenses WHERE expense_id = ?`
-	err := r.db.Get(&expense, query, expenseID)
+	err := sqlx.Get(q, &expense, query, expenseID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get shares
-	sharesQuery := `SELECT * FROM expense_shares WHERE expense_id = ?`
-	err = r.db.Select(&expense.Shares, sharesQuery, expenseID)
-	if err != nil {
+	if err := loadDetails(q, &expense); err != nil {
 		return nil, err
 	}
 
@@ -86,18 +448,16 @@ func (r *ExpenseRepository) GetByID(expenseID int) (*models.Expense, error) {
 }
 
 func (r *ExpenseRepository) GetGroupExpenses(groupID int) ([]models.Expense, error) {
-	query := `SELECT * FROM expenses WHERE group_id = ? ORDER BY created_at DESC`
+	query := `SELECT * FROM expenses WHERE group_id = ? AND deleted_at IS NULL ORDER BY created_at DESC`
 	var expenses []models.Expense
 	err := r.db.Select(&expenses, query, groupID)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get shares for each expense
-	sharesQuery := `SELECT * FROM expense_shares WHERE expense_id = ?`
+	// Get shares and items for each expense
 	for i := range expenses {
-		err = r.db.Select(&expenses[i].Shares, sharesQuery, expenses[i].ExpenseID)
-		if err != nil {
+		if err := loadDetails(r.db, &expenses[i]); err != nil {
 			return nil, err
 		}
 	}
@@ -105,85 +465,137 @@ func (r *ExpenseRepository) GetGroupExpenses(groupID int) ([]models.Expense, err
 	return expenses, nil
 }
 
+// loadDetails fills in the shares, payers and receipt items of an expense.
+func loadDetails(q sqlx.Queryer, expense *models.Expense) error {
+	sharesQuery := `SELECT * FROM expense_shares WHERE expense_id = ?`
+	err := sqlx.Select(q, &expense.Shares, sharesQuery, expense.ExpenseID)
+	if err != nil {
+		return err
+	}
+
+	payersQuery := `SELECT * FROM expense_payers WHERE expense_id = ? ORDER BY user_id`
+	err = sqlx.Select(q, &expense.Payers, payersQuery, expense.ExpenseID)
+	if err != nil {
+		return err
+	}
+
+	itemsQuery := `SELECT * FROM expense_items WHERE expense_id = ? ORDER BY item_id`
+	err = sqlx.Select(q, &expense.Items, itemsQuery, expense.ExpenseID)
+	if err != nil {
+		return err
+	}
+
+	participantsQuery := `SELECT user_id FROM expense_item_participants WHERE item_id = ? ORDER BY user_id`
+	for i := range expense.Items {
+		err = sqlx.Select(q, &expense.Items[i].Participants, participantsQuery, expense.Items[i].ItemID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetUserBalance lists the debts between the given user and the rest of the
+// group. The debts are derived from the simplified settle-up plan, so every
+// row is a payment that actually needs to happen.
 func (r *ExpenseRepository) GetUserBalance(userID, groupID int) ([]models.Balance, error) {
-	query := `
-        WITH user_balances AS (
-            SELECT 
-                es.user_id,
-                e.created_by as owed_to,
-                SUM(es.share_amount) as total_share,
-                SUM(es.paid_amount) as total_paid
-            FROM expenses e
-            JOIN expense_shares es ON e.expense_id = es.expense_id
-            WHERE e.group_id = ?
-            GROUP BY es.user_id, e.created_by
-        )
-        SELECT 
-            user_id,    -- matches Balance.UserID
-            owed_to,    -- matches Balance.OwedTo
-            (total_share - total_paid) as amount  -- matches Balance.Amount
-        FROM user_balances
-        WHERE (user_id = ? OR owed_to = ?)
-            AND (total_share - total_paid) > 0
-        ORDER BY amount DESC`
-
-	var balances []models.Balance
-	err := r.db.Select(&balances, query, groupID, userID, userID)
+	ledger, err := r.buildLedger(groupID)
 	if err != nil {
 		log.Printf("Error fetching balance sheet: %v", err)
 		return nil, fmt.Errorf("error fetching balance sheet: %v", err)
 	}
 
-	// Debug logging
-	log.Printf("Found %d balance records", len(balances))
-	for _, b := range balances {
-		log.Printf("Balance: UserID=%d, OwedTo=%d, Amount=%.2f", b.UserID, b.OwedTo, b.Amount)
+	balances := []models.Balance{}
+	for _, transfer := range settle.Simplify(ledger.Balances()) {
+		if transfer.From != userID && transfer.To != userID {
+			continue
+		}
+		balances = append(balances, models.Balance{
+			UserID: transfer.From,
+			OwedTo: transfer.To,
+			Amount: transfer.Amount,
+		})
 	}
 
+	sort.SliceStable(balances, func(i, j int) bool {
+		return balances[i].Amount > balances[j].Amount
+	})
+
 	return balances, nil
 }
 
+// Settle records a payment between two group members. Settlements are netted
+// against expenses when balances are computed, so expense shares are left
+// untouched.
 func (r *ExpenseRepository) Settle(settlement *models.Settlement) error {
-	tx, err := r.db.Beginx()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
+	query := `
+        INSERT INTO settlements (payer_id, payee_id, amount, group_id, notes, write_off)
+        VALUES (?, ?, ?, ?, ?, ?)
+        RETURNING settlement_id, payer_id, payee_id, amount, group_id, settled_at, notes, write_off`
 
-	// Create settlement record
-	_, err = tx.Exec(`
-        INSERT INTO settlements (payer_id, payee_id, amount, group_id, notes)
-        VALUES (?, ?, ?, ?, ?)`,
+	return r.db.QueryRowx(query,
 		settlement.PayerID,
 		settlement.PayeeID,
 		settlement.Amount,
 		settlement.GroupID,
 		settlement.Notes,
-	)
+		settlement.WriteOff,
+	).StructScan(settlement)
+}
+
+func (r *ExpenseRepository) GetGroupSettlements(groupID int) ([]models.Settlement, error) {
+	query := `SELECT * FROM settlements WHERE group_id = ? ORDER BY settled_at DESC`
+	var settlements []models.Settlement
+	err := r.db.Select(&settlements, query, groupID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return settlements, nil
+}
 
-	// Update paid amounts in expense_shares
-	// This is a simplified version - in a real app, you'd need a more sophisticated
-	// algorithm to determine which expenses to mark as paid
-	_, err = tx.Exec(`
-        UPDATE expense_shares
-        SET paid_amount = share_amount
-        WHERE user_id = ?
-        AND expense_id IN (
-            SELECT expense_id
-            FROM expenses
-            WHERE group_id = ?
-            AND created_by = ?
-        )`,
-		settlement.PayerID,
-		settlement.GroupID,
-		settlement.PayeeID,
-	)
+// GetNetBalances returns the net position of every member of a group:
+// what they paid, minus what they owe, adjusted by settlements.
+func (r *ExpenseRepository) GetNetBalances(groupID int) ([]models.NetBalance, error) {
+	ledger, err := r.buildLedger(groupID)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("error fetching net balances: %v", err)
+	}
+
+	net := ledger.Balances()
+	balances := make([]models.NetBalance, 0, len(net))
+	for _, userID := range ledger.Members() {
+		balances = append(balances, models.NetBalance{UserID: userID, Amount: net[userID]})
+	}
+	return balances, nil
+}
+
+// buildLedger feeds every expense and settlement of a group into a ledger
+// that starts with all current members at zero. Expenses are converted to
+// the group's currency, which settlements are recorded in.
+func (r *ExpenseRepository) buildLedger(groupID int) (*settle.Ledger, error) {
+	var memberIDs []int
+	err := r.db.Select(&memberIDs, `SELECT user_id FROM group_members WHERE group_id = ?`, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	expenses, err := r.GetGroupExpenses(groupID)
+	if err != nil {
+		return nil, err
 	}
 
-	return tx.Commit()
+	settlements, err := r.GetGroupSettlements(groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := settle.NewLedger(memberIDs...)
+	for i := range expenses {
+		ledger.AddExpense(expenses[i].BasePayments(), expenses[i].BaseOwed())
+	}
+	for _, s := range settlements {
+		ledger.AddSettlement(s.PayerID, s.PayeeID, s.Amount)
+	}
+	return ledger, nil
 }
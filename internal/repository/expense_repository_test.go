@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"expense-sharing-api/internal/models"
+	"testing"
+)
+
+func TestExpenseUpdateWithoutChanges(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserRepository(db)
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := users.Create(&models.UserRegister{Email: name + "@example.com", FullName: name}, "hash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	group, err := NewGroupRepository(db).Create(&models.GroupCreate{Name: "Flat", Members: []int{1, 2}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewExpenseRepository(db)
+
+	created, err := repo.Create(&models.ExpenseCreate{
+		GroupID:      group.GroupID,
+		Description:  "Dinner",
+		Amount:       1001,
+		SplitType:    models.SplitEqual,
+		Currency:     "USD",
+		ExchangeRate: 1,
+		Shares:       []models.ShareCreate{{UserID: 1}, {UserID: 2}},
+	}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unchanged := created.ToCreate()
+	got, err := repo.Update(created.ExpenseID, &unchanged, created.CreatedBy, 2)
+	if err != nil {
+		t.Fatalf("Update returned error %v", err)
+	}
+	if got.Description != "Dinner" || got.Amount != 1001 {
+		t.Errorf("Update without changes = %+v, want the stored expense", got)
+	}
+
+	changed := created.ToCreate()
+	changed.Description = "Team dinner"
+	if _, err := repo.Update(created.ExpenseID, &changed, created.CreatedBy, 2); err != nil {
+		t.Fatalf("Update returned error %v", err)
+	}
+
+	history, err := repo.GetHistory(created.ExpenseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []models.RevisionAction
+	for _, revision := range history {
+		actions = append(actions, revision.Action)
+	}
+	if len(actions) != 2 || actions[0] != models.RevisionCreate || actions[1] != models.RevisionUpdate {
+		t.Errorf("history actions = %v, want [CREATE UPDATE]", actions)
+	}
+	if changes := history[len(history)-1].Changes; len(changes) != 1 || changes[0].Field != "description" {
+		t.Errorf("changes of the update = %+v, want only the description", changes)
+	}
+}
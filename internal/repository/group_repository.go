@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"database/sql"
+	"errors"
 	"expense-sharing-api/internal/models"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -25,7 +28,7 @@ func (r *GroupRepository) Create(group *models.GroupCreate, createdBy int) (*mod
 	query := `
         INSERT INTO groups (name, description, created_by)
         VALUES (?, ?, ?)
-        RETURNING group_id, name, description, created_by, created_at`
+        RETURNING group_id, name, description, created_by, created_at, default_currency, members_can_edit_others`
 
 	var created models.Group
 	err = tx.QueryRowx(query, group.Name, group.Description, createdBy).StructScan(&created)
@@ -33,25 +36,17 @@ func (r *GroupRepository) Create(group *models.GroupCreate, createdBy int) (*mod
 		return nil, err
 	}
 
-	// Add members
-	memberQuery := `INSERT INTO group_members (group_id, user_id) VALUES (?, ?)`
-	for _, memberID := range group.Members {
-		_, err = tx.Exec(memberQuery, created.GroupID, memberID)
-		if err != nil {
-			return nil, err
-		}
+	// The creator owns the group, everyone else joins as a regular member
+	memberQuery := `INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)`
+	_, err = tx.Exec(memberQuery, created.GroupID, createdBy, models.RoleOwner)
+	if err != nil {
+		return nil, err
 	}
-
-	// Add creator as member if not already included
-	creatorIncluded := false
 	for _, memberID := range group.Members {
 		if memberID == createdBy {
-			creatorIncluded = true
-			break
+			continue
 		}
-	}
-	if !creatorIncluded {
-		_, err = tx.Exec(memberQuery, created.GroupID, createdBy)
+		_, err = tx.Exec(memberQuery, created.GroupID, memberID, models.RoleMember)
 		if err != nil {
 			return nil, err
 		}
@@ -75,7 +70,7 @@ func (r *GroupRepository) GetByID(groupID int) (*models.Group, error) {
 
 	// Get members
 	membersQuery := `
-        SELECT u.*
+        SELECT u.*, gm.role
         FROM users u
         JOIN group_members gm ON u.user_id = gm.user_id
         WHERE gm.group_id = ?`
@@ -85,17 +80,377 @@ func (r *GroupRepository) GetByID(groupID int) (*models.Group, error) {
 		return nil, err
 	}
 
+	participantsQuery := `SELECT user_id FROM group_default_participants WHERE group_id = ? ORDER BY user_id`
+	err = r.db.Select(&group.DefaultParticipants, participantsQuery, groupID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &group, nil
 }
 
-func (r *GroupRepository) GetUserGroups(userID int) ([]models.Group, error) {
+func (r *GroupRepository) GetUserGroups(userID int, filter models.GroupFilter) ([]models.Group, error) {
 	query := `
         SELECT g.*
         FROM groups g
         JOIN group_members gm ON g.group_id = gm.group_id
         WHERE gm.user_id = ?`
+	switch filter {
+	case models.GroupsActive:
+		query += ` AND g.archived_at IS NULL`
+	case models.GroupsArchived:
+		query += ` AND g.archived_at IS NOT NULL`
+	}
 
 	var groups []models.Group
 	err := r.db.Select(&groups, query, userID)
 	return groups, err
 }
+
+func (r *GroupRepository) GetMemberIDs(groupID int) ([]int, error) {
+	var memberIDs []int
+	query := `SELECT user_id FROM group_members WHERE group_id = ? ORDER BY user_id`
+	err := r.db.Select(&memberIDs, query, groupID)
+	return memberIDs, err
+}
+
+func (r *GroupRepository) IsMember(groupID, userID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM group_members WHERE group_id = ? AND user_id = ?`
+	err := r.db.Get(&count, query, groupID, userID)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Update changes the group's name, description and settings. Fields left
+// nil in the update keep their current value.
+func (r *GroupRepository) Update(groupID int, update *models.GroupUpdate) (*models.Group, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// An empty split type clears the default, which is stored as NULL
+	var splitType *string
+	if update.DefaultSplitType != nil && *update.DefaultSplitType != "" {
+		value := string(*update.DefaultSplitType)
+		splitType = &value
+	}
+
+	query := `
+        UPDATE groups
+        SET name = COALESCE(?, name),
+            description = COALESCE(?, description),
+            default_currency = COALESCE(?, default_currency),
+            default_split_type = CASE WHEN ? THEN ? ELSE default_split_type END,
+            members_can_edit_others = COALESCE(?, members_can_edit_others)
+        WHERE group_id = ?`
+	_, err = tx.Exec(query,
+		update.Name,
+		update.Description,
+		update.DefaultCurrency,
+		update.DefaultSplitType != nil, splitType,
+		update.MembersCanEditOthers,
+		groupID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.DefaultParticipants != nil {
+		if _, err := tx.Exec(`DELETE FROM group_default_participants WHERE group_id = ?`, groupID); err != nil {
+			return nil, err
+		}
+		for _, userID := range *update.DefaultParticipants {
+			query := `INSERT INTO group_default_participants (group_id, user_id) VALUES (?, ?)`
+			if _, err := tx.Exec(query, groupID, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(groupID)
+}
+
+// HasTransactions reports whether any expenses, including those in the
+// trash, or settlements have been recorded in the group.
+func (r *GroupRepository) HasTransactions(groupID int) (bool, error) {
+	var count int
+	query := `
+        SELECT (SELECT COUNT(*) FROM expenses WHERE group_id = ?)
+            + (SELECT COUNT(*) FROM settlements WHERE group_id = ?)`
+	err := r.db.Get(&count, query, groupID, groupID)
+	return count > 0, err
+}
+
+// MembersCanEditOthers reports whether the group lets every member change
+// expenses created by someone else.
+func (r *GroupRepository) MembersCanEditOthers(groupID int) (bool, error) {
+	var allowed bool
+	query := `SELECT members_can_edit_others FROM groups WHERE group_id = ?`
+	err := r.db.Get(&allowed, query, groupID)
+	return allowed, err
+}
+
+// IsArchived reports whether the group has been archived and is read-only.
+func (r *GroupRepository) IsArchived(groupID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM groups WHERE group_id = ? AND archived_at IS NOT NULL`
+	err := r.db.Get(&count, query, groupID)
+	return count > 0, err
+}
+
+func (r *GroupRepository) Archive(groupID int) error {
+	query := `UPDATE groups SET archived_at = CURRENT_TIMESTAMP WHERE group_id = ?`
+	_, err := r.db.Exec(query, groupID)
+	return err
+}
+
+func (r *GroupRepository) Unarchive(groupID int) error {
+	query := `UPDATE groups SET archived_at = NULL WHERE group_id = ?`
+	_, err := r.db.Exec(query, groupID)
+	return err
+}
+
+func (r *GroupRepository) AddMember(groupID, userID int, role models.Role) error {
+	query := `INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)`
+	_, err := r.db.Exec(query, groupID, userID, role)
+	return err
+}
+
+// GetRole returns the user's role in the group, or an empty role if they
+// are not a member.
+func (r *GroupRepository) GetRole(groupID, userID int) (models.Role, error) {
+	var role models.Role
+	query := `SELECT role FROM group_members WHERE group_id = ? AND user_id = ?`
+	err := r.db.Get(&role, query, groupID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+func (r *GroupRepository) SetRole(groupID, userID int, role models.Role) error {
+	query := `UPDATE group_members SET role = ? WHERE group_id = ? AND user_id = ?`
+	_, err := r.db.Exec(query, role, groupID, userID)
+	return err
+}
+
+// TransferOwnership makes another member the owner of the group. The
+// previous owner stays on as an admin.
+func (r *GroupRepository) TransferOwnership(groupID, fromID, toID int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE group_members SET role = ? WHERE group_id = ? AND user_id = ?`
+	if _, err := tx.Exec(query, models.RoleAdmin, groupID, fromID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(query, models.RoleOwner, groupID, toID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMember takes a user out of a group. Any write-offs that clear the
+// member's remaining balance are recorded in the same transaction.
+func (r *GroupRepository) RemoveMember(groupID, userID int, writeOffs []models.Settlement) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO settlements (payer_id, payee_id, amount, group_id, notes, write_off)
+        VALUES (?, ?, ?, ?, ?, 1)
+        RETURNING settlement_id, payer_id, payee_id, amount, group_id, settled_at, notes, write_off`
+	for i := range writeOffs {
+		s := &writeOffs[i]
+		err := tx.QueryRowx(query, s.PayerID, s.PayeeID, s.Amount, groupID, s.Notes).StructScan(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"group_members", "group_default_participants"} {
+		query := fmt.Sprintf(`DELETE FROM %s WHERE group_id = ? AND user_id = ?`, table)
+		if _, err := tx.Exec(query, groupID, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddGuest creates a guest user and adds them to the group as a member.
+func (r *GroupRepository) AddGuest(groupID int, fullName string) (*models.Member, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO users (full_name, is_guest) VALUES (?, 1)
+        RETURNING user_id, email, full_name, password_hash, is_guest, created_at`
+
+	guest := models.Member{Role: models.RoleMember}
+	if err := tx.QueryRowx(query, fullName).StructScan(&guest.User); err != nil {
+		return nil, err
+	}
+
+	memberQuery := `INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)`
+	if _, err := tx.Exec(memberQuery, groupID, guest.UserID, guest.Role); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &guest, nil
+}
+
+// SharedExpenses lists the expenses that two users both take part in, as
+// participants or as payers. A guest cannot be merged into a user while
+// these exist, since each user can only appear once per expense.
+func (r *GroupRepository) SharedExpenses(guestID, userID int) ([]int, error) {
+	expenseIDs := []int{}
+	query := `
+        SELECT expense_id FROM expense_shares WHERE user_id IN (?, ?)
+        GROUP BY expense_id HAVING COUNT(*) > 1
+        UNION
+        SELECT expense_id FROM expense_payers WHERE user_id IN (?, ?)
+        GROUP BY expense_id HAVING COUNT(*) > 1
+        ORDER BY expense_id`
+	err := r.db.Select(&expenseIDs, query, guestID, userID, guestID, userID)
+	return expenseIDs, err
+}
+
+// GuestElsewhere reports whether the guest belongs to, or has anything
+// recorded in, a group other than the given one.
+func (r *GroupRepository) GuestElsewhere(guestID, groupID int) (bool, error) {
+	var count int
+	query := `
+        SELECT (SELECT COUNT(*) FROM group_members WHERE user_id = ? AND group_id != ?)
+            + (SELECT COUNT(*) FROM expense_shares s
+                JOIN expenses e ON e.expense_id = s.expense_id
+                WHERE s.user_id = ? AND e.group_id != ?)
+            + (SELECT COUNT(*) FROM expense_payers p
+                JOIN expenses e ON e.expense_id = p.expense_id
+                WHERE p.user_id = ? AND e.group_id != ?)
+            + (SELECT COUNT(*) FROM settlements
+                WHERE ? IN (payer_id, payee_id) AND group_id != ?)`
+	err := r.db.Get(&count, query,
+		guestID, groupID,
+		guestID, groupID,
+		guestID, groupID,
+		guestID, groupID,
+	)
+	return count > 0, err
+}
+
+// MergeGuest moves everything recorded for a guest in the group over to a
+// registered user: their shares, payments, settlements and membership. Each
+// expense that changes gets a revision, settlements between the two of them
+// are dropped since they would now be payments to oneself, and the guest is
+// deleted afterwards. Where the user is already a member they keep their own
+// role.
+func (r *GroupRepository) MergeGuest(groupID, guestID, userID, mergedBy int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Trashed expenses are included, they can still be restored
+	var expenseIDs []int
+	query := `
+        SELECT expense_id FROM expenses
+        WHERE group_id = ? AND expense_id IN (
+            SELECT expense_id FROM expense_shares WHERE user_id = ?
+            UNION
+            SELECT expense_id FROM expense_payers WHERE user_id = ?
+            UNION
+            SELECT i.expense_id FROM expense_items i
+            JOIN expense_item_participants ip ON ip.item_id = i.item_id
+            WHERE ip.user_id = ?
+        )
+        ORDER BY expense_id`
+	if err := tx.Select(&expenseIDs, query, groupID, guestID, guestID, guestID); err != nil {
+		return err
+	}
+	for _, expenseID := range expenseIDs {
+		if err := recordBaseline(tx, expenseID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`
+        DELETE FROM settlements
+        WHERE group_id = ? AND ((payer_id = ? AND payee_id = ?) OR (payer_id = ? AND payee_id = ?))`,
+		groupID, guestID, userID, userID, guestID); err != nil {
+		return err
+	}
+
+	statements := []string{
+		`UPDATE expense_shares SET user_id = ?
+         WHERE user_id = ? AND expense_id IN (SELECT expense_id FROM expenses WHERE group_id = ?)`,
+		`UPDATE expense_payers SET user_id = ?
+         WHERE user_id = ? AND expense_id IN (SELECT expense_id FROM expenses WHERE group_id = ?)`,
+		`UPDATE expense_item_participants SET user_id = ?
+         WHERE user_id = ? AND item_id IN (
+             SELECT i.item_id FROM expense_items i
+             JOIN expenses e ON e.expense_id = i.expense_id
+             WHERE e.group_id = ?)`,
+		`UPDATE settlements SET payer_id = ? WHERE payer_id = ? AND group_id = ?`,
+		`UPDATE settlements SET payee_id = ? WHERE payee_id = ? AND group_id = ?`,
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, userID, guestID, groupID); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"group_members", "group_default_participants"} {
+		query := fmt.Sprintf(`
+            DELETE FROM %[1]s
+            WHERE user_id = ? AND group_id = ?
+                AND EXISTS (SELECT 1 FROM %[1]s WHERE user_id = ? AND group_id = ?)`, table)
+		if _, err := tx.Exec(query, guestID, groupID, userID, groupID); err != nil {
+			return err
+		}
+		query = fmt.Sprintf(`UPDATE %s SET user_id = ? WHERE user_id = ? AND group_id = ?`, table)
+		if _, err := tx.Exec(query, userID, guestID, groupID); err != nil {
+			return err
+		}
+	}
+
+	for _, expenseID := range expenseIDs {
+		expense, err := getExpense(tx, expenseID)
+		if err != nil {
+			return err
+		}
+		if err := recordRevision(tx, expense, models.RevisionUpdate, mergedBy); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM users WHERE user_id = ? AND is_guest = 1`, guestID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"errors"
+	"expense-sharing-api/internal/models"
+	"expense-sharing-api/pkg/token"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrInvitationNotPending is returned when an invitation was accepted or
+// revoked by the time it was redeemed.
+var ErrInvitationNotPending = errors.New("invitation is no longer pending")
+
+type InvitationRepository struct {
+	db *sqlx.DB
+}
+
+func NewInvitationRepository(db *sqlx.DB) *InvitationRepository {
+	return &InvitationRepository{db: db}
+}
+
+// invitationQuery selects invitations together with their group's name and
+// their status, which is derived from the timestamps.
+const invitationQuery = `
+    SELECT i.*, g.name AS group_name,
+        CASE
+            WHEN i.revoked_at IS NOT NULL THEN 'revoked'
+            WHEN i.accepted_at IS NOT NULL THEN 'accepted'
+            WHEN i.expires_at <= CURRENT_TIMESTAMP THEN 'expired'
+            ELSE 'pending'
+        END AS status
+    FROM group_invitations i
+    JOIN groups g ON g.group_id = i.group_id`
+
+func (r *InvitationRepository) Create(groupID int, invite *models.InvitationCreate, invitedBy int) (*models.Invitation, error) {
+	secret, err := token.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+        INSERT INTO group_invitations (group_id, email, role, token, invited_by, expires_at)
+        VALUES (?, ?, ?, ?, ?, datetime('now', ?))
+        RETURNING invitation_id`
+
+	var invitationID int
+	err = r.db.Get(&invitationID, query,
+		groupID,
+		strings.ToLower(invite.Email),
+		invite.Role,
+		secret,
+		invitedBy,
+		fmt.Sprintf("+%d days", invite.ExpiresInDays),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(invitationID)
+}
+
+func (r *InvitationRepository) GetByID(invitationID int) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Get(&invitation, invitationQuery+` WHERE i.invitation_id = ?`, invitationID)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepository) GetByToken(secret string) (*models.Invitation, error) {
+	var invitation models.Invitation
+	err := r.db.Get(&invitation, invitationQuery+` WHERE i.token = ?`, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *InvitationRepository) GetGroupInvitations(groupID int) ([]models.Invitation, error) {
+	invitations := []models.Invitation{}
+	query := invitationQuery + ` WHERE i.group_id = ? ORDER BY i.created_at DESC, i.invitation_id DESC`
+	err := r.db.Select(&invitations, query, groupID)
+	return invitations, err
+}
+
+// GetPendingForEmail lists the invitations that the owner of the email
+// address can still accept.
+func (r *InvitationRepository) GetPendingForEmail(email string) ([]models.Invitation, error) {
+	invitations := []models.Invitation{}
+	query := `SELECT * FROM (` + invitationQuery + `) WHERE email = ? AND status = 'pending' ORDER BY created_at DESC`
+	err := r.db.Select(&invitations, query, strings.ToLower(email))
+	return invitations, err
+}
+
+// HasPending reports whether the email address already has an invitation
+// to the group that can be accepted.
+func (r *InvitationRepository) HasPending(groupID int, email string) (bool, error) {
+	var count int
+	query := `
+        SELECT COUNT(*) FROM group_invitations
+        WHERE group_id = ? AND email = ? AND revoked_at IS NULL AND accepted_at IS NULL
+            AND expires_at > CURRENT_TIMESTAMP`
+	err := r.db.Get(&count, query, groupID, strings.ToLower(email))
+	return count > 0, err
+}
+
+func (r *InvitationRepository) Revoke(invitationID int) error {
+	query := `UPDATE group_invitations SET revoked_at = CURRENT_TIMESTAMP WHERE invitation_id = ?`
+	_, err := r.db.Exec(query, invitationID)
+	return err
+}
+
+// Accept redeems an invitation for the user, adding them to the group with
+// the invited role. Users who are already members keep their current role.
+func (r *InvitationRepository) Accept(invitation *models.Invitation, userID int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := acceptInvitation(tx, invitation, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// acceptInvitation does the work of Accept inside the caller's transaction,
+// so registering with an invitation can redeem it atomically.
+func acceptInvitation(tx *sqlx.Tx, invitation *models.Invitation, userID int) error {
+	query := `
+        UPDATE group_invitations SET accepted_at = CURRENT_TIMESTAMP, accepted_by = ?
+        WHERE invitation_id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+            AND expires_at > CURRENT_TIMESTAMP`
+	result, err := tx.Exec(query, userID, invitation.InvitationID)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return fmt.Errorf("%w: invitation %d", ErrInvitationNotPending, invitation.InvitationID)
+	}
+
+	memberQuery := `
+        INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)
+        ON CONFLICT (group_id, user_id) DO NOTHING`
+	_, err = tx.Exec(memberQuery, invitation.GroupID, userID, invitation.Role)
+	return err
+}
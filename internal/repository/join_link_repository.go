@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"errors"
+	"expense-sharing-api/internal/models"
+	"expense-sharing-api/pkg/token"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrJoinLinkUnusable is returned when a join link was revoked, expired or
+// used up by the time it was redeemed.
+var ErrJoinLinkUnusable = errors.New("join link can no longer be used")
+
+// ErrJoinRequestNotPending is returned when a join request was decided by
+// someone else by the time the decision was saved.
+var ErrJoinRequestNotPending = errors.New("join request is no longer pending")
+
+type JoinLinkRepository struct {
+	db *sqlx.DB
+}
+
+func NewJoinLinkRepository(db *sqlx.DB) *JoinLinkRepository {
+	return &JoinLinkRepository{db: db}
+}
+
+// joinLinkQuery selects join links together with their group's name and
+// their status, which is derived from the timestamps and usage count.
+const joinLinkQuery = `
+    SELECT l.*, g.name AS group_name,
+        CASE
+            WHEN l.revoked_at IS NOT NULL THEN 'revoked'
+            WHEN l.expires_at IS NOT NULL AND l.expires_at <= CURRENT_TIMESTAMP THEN 'expired'
+            WHEN l.max_uses IS NOT NULL AND l.uses >= l.max_uses THEN 'exhausted'
+            ELSE 'active'
+        END AS status
+    FROM group_join_links l
+    JOIN groups g ON g.group_id = l.group_id`
+
+const joinRequestQuery = `
+    SELECT r.*, u.full_name, u.email
+    FROM group_join_requests r
+    JOIN users u ON u.user_id = r.user_id`
+
+func (r *JoinLinkRepository) Create(groupID int, link *models.JoinLinkCreate, createdBy int) (*models.JoinLink, error) {
+	secret, err := token.Generate()
+	if err != nil {
+		return nil, err
+	}
+
+	// A NULL modifier makes datetime() return NULL, so links created without
+	// an expiry never expire
+	var expiresIn *string
+	if link.ExpiresInDays != nil {
+		modifier := fmt.Sprintf("+%d days", *link.ExpiresInDays)
+		expiresIn = &modifier
+	}
+
+	query := `
+        INSERT INTO group_join_links (group_id, token, role, requires_approval, max_uses, created_by, expires_at)
+        VALUES (?, ?, ?, ?, ?, ?, datetime('now', ?))
+        RETURNING link_id`
+
+	var linkID int
+	err = r.db.Get(&linkID, query,
+		groupID,
+		secret,
+		link.Role,
+		link.RequiresApproval,
+		link.MaxUses,
+		createdBy,
+		expiresIn,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(linkID)
+}
+
+func (r *JoinLinkRepository) GetByID(linkID int) (*models.JoinLink, error) {
+	var link models.JoinLink
+	err := r.db.Get(&link, joinLinkQuery+` WHERE l.link_id = ?`, linkID)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *JoinLinkRepository) GetByToken(secret string) (*models.JoinLink, error) {
+	var link models.JoinLink
+	err := r.db.Get(&link, joinLinkQuery+` WHERE l.token = ?`, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+func (r *JoinLinkRepository) GetGroupLinks(groupID int) ([]models.JoinLink, error) {
+	links := []models.JoinLink{}
+	query := joinLinkQuery + ` WHERE l.group_id = ? ORDER BY l.created_at DESC, l.link_id DESC`
+	err := r.db.Select(&links, query, groupID)
+	return links, err
+}
+
+func (r *JoinLinkRepository) Revoke(linkID int) error {
+	query := `UPDATE group_join_links SET revoked_at = CURRENT_TIMESTAMP WHERE link_id = ?`
+	_, err := r.db.Exec(query, linkID)
+	return err
+}
+
+// Redeem uses up one use of the link for the user. Links that require
+// approval create a pending join request, which is returned, while all other
+// links add the user to the group straight away and return nil.
+func (r *JoinLinkRepository) Redeem(link *models.JoinLink, userID int) (*models.JoinRequest, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Checking the link's state in the update keeps concurrent redemptions
+	// from going over the usage cap
+	query := `
+        UPDATE group_join_links SET uses = uses + 1
+        WHERE link_id = ? AND revoked_at IS NULL
+            AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+            AND (max_uses IS NULL OR uses < max_uses)`
+	result, err := tx.Exec(query, link.LinkID)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if updated == 0 {
+		return nil, fmt.Errorf("%w: join link %d", ErrJoinLinkUnusable, link.LinkID)
+	}
+
+	if !link.RequiresApproval {
+		memberQuery := `
+            INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)
+            ON CONFLICT (group_id, user_id) DO NOTHING`
+		if _, err := tx.Exec(memberQuery, link.GroupID, userID, link.Role); err != nil {
+			return nil, err
+		}
+		return nil, tx.Commit()
+	}
+
+	requestQuery := `
+        INSERT INTO group_join_requests (group_id, link_id, user_id, role)
+        VALUES (?, ?, ?, ?)
+        RETURNING request_id`
+	var requestID int
+	if err := tx.Get(&requestID, requestQuery, link.GroupID, link.LinkID, userID, link.Role); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetRequest(requestID)
+}
+
+func (r *JoinLinkRepository) GetRequest(requestID int) (*models.JoinRequest, error) {
+	var request models.JoinRequest
+	err := r.db.Get(&request, joinRequestQuery+` WHERE r.request_id = ?`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// GetPendingRequests lists the join requests of the group that are waiting
+// for a decision, oldest first.
+func (r *JoinLinkRepository) GetPendingRequests(groupID int) ([]models.JoinRequest, error) {
+	requests := []models.JoinRequest{}
+	query := joinRequestQuery + ` WHERE r.group_id = ? AND r.status = 'pending' ORDER BY r.created_at, r.request_id`
+	err := r.db.Select(&requests, query, groupID)
+	return requests, err
+}
+
+// HasPendingRequest reports whether the user is already waiting to be let
+// into the group.
+func (r *JoinLinkRepository) HasPendingRequest(groupID, userID int) (bool, error) {
+	var count int
+	query := `SELECT COUNT(*) FROM group_join_requests WHERE group_id = ? AND user_id = ? AND status = 'pending'`
+	err := r.db.Get(&count, query, groupID, userID)
+	return count > 0, err
+}
+
+// Decide approves or rejects a pending join request. Approving it adds the
+// requester to the group with the role of the link they used.
+func (r *JoinLinkRepository) Decide(request *models.JoinRequest, approve bool, decidedBy int) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status := models.JoinRequestRejected
+	if approve {
+		status = models.JoinRequestApproved
+	}
+
+	query := `
+        UPDATE group_join_requests SET status = ?, decided_at = CURRENT_TIMESTAMP, decided_by = ?
+        WHERE request_id = ? AND status = 'pending'`
+	result, err := tx.Exec(query, status, decidedBy, request.RequestID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return fmt.Errorf("%w: join request %d", ErrJoinRequestNotPending, request.RequestID)
+	}
+
+	if approve {
+		memberQuery := `
+            INSERT INTO group_members (group_id, user_id, role) VALUES (?, ?, ?)
+            ON CONFLICT (group_id, user_id) DO NOTHING`
+		if _, err := tx.Exec(memberQuery, request.GroupID, request.UserID, request.Role); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
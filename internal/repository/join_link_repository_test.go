@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"errors"
+	"expense-sharing-api/internal/models"
+	"testing"
+)
+
+func TestJoinLinkRaces(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserRepository(db)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := users.Create(&models.UserRegister{Email: name + "@example.com", FullName: name}, "hash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	group, err := NewGroupRepository(db).Create(&models.GroupCreate{Name: "Flat", Members: []int{1}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := NewJoinLinkRepository(db)
+
+	// Both joiners loaded the link while it still had a use left
+	maxUses := 1
+	link, err := repo.Create(group.GroupID, &models.JoinLinkCreate{Role: models.RoleMember, MaxUses: &maxUses}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Redeem(link, 2); err != nil {
+		t.Fatalf("first Redeem returned error %v", err)
+	}
+	if _, err := repo.Redeem(link, 3); !errors.Is(err, ErrJoinLinkUnusable) {
+		t.Errorf("Redeem of a used up link = %v, want ErrJoinLinkUnusable", err)
+	}
+
+	// Two admins decide on the same pending request
+	link, err = repo.Create(group.GroupID, &models.JoinLinkCreate{Role: models.RoleMember, RequiresApproval: true}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := repo.Redeem(link, 3)
+	if err != nil || request == nil {
+		t.Fatalf("Redeem = %+v, %v, want a pending join request", request, err)
+	}
+	if err := repo.Decide(request, true, 1); err != nil {
+		t.Fatalf("first Decide returned error %v", err)
+	}
+	if err := repo.Decide(request, false, 2); !errors.Is(err, ErrJoinRequestNotPending) {
+		t.Errorf("Decide of a decided request = %v, want ErrJoinRequestNotPending", err)
+	}
+}
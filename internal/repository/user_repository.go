@@ -15,13 +15,37 @@ func NewUserRepository(db *sqlx.DB) *UserRepository {
 }
 
 func (r *UserRepository) Create(user *models.UserRegister, passwordHash string) (*models.User, error) {
+	return insertUser(r.db, user, passwordHash)
+}
+
+// CreateWithInvitation registers the user and redeems their invitation in one
+// transaction, so the account is only created if it also joins the group.
+func (r *UserRepository) CreateWithInvitation(user *models.UserRegister, passwordHash string, invitation *models.Invitation) (*models.User, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	created, err := insertUser(tx, user, passwordHash)
+	if err != nil {
+		return nil, err
+	}
+	if err := acceptInvitation(tx, invitation, created.UserID); err != nil {
+		return nil, err
+	}
+
+	return created, tx.Commit()
+}
+
+func insertUser(q sqlx.Queryer, user *models.UserRegister, passwordHash string) (*models.User, error) {
 	query := `
         INSERT INTO users (email, full_name, password_hash)
         VALUES (?, ?, ?)
         RETURNING user_id, email, full_name, created_at`
 
 	var created models.User
-	err := r.db.QueryRowx(query, user.Email, user.FullName, passwordHash).StructScan(&created)
+	err := q.QueryRowx(query, user.Email, user.FullName, passwordHash).StructScan(&created)
 	if err != nil {
 		return nil, err
 	}
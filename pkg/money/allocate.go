@@ -0,0 +1,61 @@
+package money
+
+import "math/bits"
+
+// Split divides the amount into n parts that differ by at most one minor
+// unit. Leftover minor units go to the first parts, so callers control who
+// receives them by ordering.
+func (m Money) Split(n int) []Money {
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return m.Allocate(weights)
+}
+
+// Allocate divides the amount in proportion to the given non-negative
+// weights. The parts always add up to the original amount: each part is
+// rounded down and the leftover minor units are handed out by largest
+// remainder, ties going to the earlier part. If every weight is zero all
+// parts are zero.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+
+	var total uint64
+	for _, w := range weights {
+		total += uint64(w)
+	}
+	if total == 0 {
+		return parts
+	}
+
+	units := uint64(m.Abs())
+	remainders := make([]uint64, len(weights))
+	var allocated uint64
+	for i, w := range weights {
+		// units*w/total without overflowing, the quotient never exceeds units
+		hi, lo := bits.Mul64(units, uint64(w))
+		quotient, remainder := bits.Div64(hi, lo, total)
+		parts[i] = Money(quotient)
+		remainders[i] = remainder
+		allocated += quotient
+	}
+
+	for left := units - allocated; left > 0; left-- {
+		best := -1
+		for i, r := range remainders {
+			if weights[i] > 0 && (best < 0 || r > remainders[best]) {
+				best = i
+			}
+		}
+		parts[best]++
+		remainders[best] = 0
+	}
+
+	if m < 0 {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts
+}
@@ -0,0 +1,87 @@
+package money
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Money
+		weights []int64
+		want    []Money
+	}{
+		{"even", 900, []int64{1, 1, 1}, []Money{300, 300, 300}},
+		{"remainder goes to the earlier parts", 1000, []int64{1, 1, 1}, []Money{334, 333, 333}},
+		{"largest remainder wins", 100, []int64{1, 2}, []Money{33, 67}},
+		{"negative amount", -1000, []int64{1, 1, 1}, []Money{-334, -333, -333}},
+		{"zero weight gets nothing", 1001, []int64{1, 0, 1}, []Money{501, 0, 500}},
+		{"leading zero weight", 5, []int64{0, 1, 1}, []Money{0, 3, 2}},
+		{"all weights zero", 1000, []int64{0, 0}, []Money{0, 0}},
+		{"no weights", 1000, []int64{}, []Money{}},
+		{"zero amount", 0, []int64{3, 7}, []Money{0, 0}},
+		{"one unit among many", 1, []int64{1, 1, 1, 1}, []Money{1, 0, 0, 0}},
+		{"percentages", 10000, []int64{3333, 3333, 3334}, []Money{3333, 3333, 3334}},
+		{"large values do not overflow", math.MaxInt64, []int64{math.MaxInt64, 1}, []Money{math.MaxInt64 - 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.amount.Allocate(tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Money(%d).Allocate(%v) = %v, want %v", tt.amount, tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllocateSumsToAmount(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for run := 0; run < 2000; run++ {
+		amount := Money(random.Int63n(2_000_001) - 1_000_000)
+		weights := make([]int64, 1+random.Intn(8))
+		positive := false
+		for i := range weights {
+			// Roughly a third of the weights are zero
+			if random.Intn(3) > 0 {
+				weights[i] = random.Int63n(10_000)
+			}
+			positive = positive || weights[i] > 0
+		}
+		if !positive {
+			continue
+		}
+
+		parts := amount.Allocate(weights)
+		var sum Money
+		for i, part := range parts {
+			sum += part
+			if weights[i] == 0 && part != 0 {
+				t.Fatalf("Money(%d).Allocate(%v) gave %d to a zero weight", amount, weights, part)
+			}
+			if (amount < 0 && part > 0) || (amount > 0 && part < 0) {
+				t.Fatalf("Money(%d).Allocate(%v) = %v, parts changed sign", amount, weights, parts)
+			}
+		}
+		if sum != amount {
+			t.Fatalf("Money(%d).Allocate(%v) = %v, sums to %d", amount, weights, parts, sum)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	got := Money(1000).Split(3)
+	want := []Money{334, 333, 333}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Money(1000).Split(3) = %v, want %v", got, want)
+	}
+
+	got = Money(-7).Split(2)
+	want = []Money{-4, -3}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Money(-7).Split(2) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,58 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"regexp"
+)
+
+// DefaultCurrency is the currency of groups that have not chosen one.
+const DefaultCurrency = "USD"
+
+// ErrOutOfRange is returned when the result of a calculation does not fit
+// in a Money.
+var ErrOutOfRange = errors.New("amount out of range")
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// minorDigits lists the ISO 4217 currencies whose minor unit is not a
+// hundredth of the major unit. Every other currency has two decimal places.
+var minorDigits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0,
+	"KRW": 0, "PYG": 0, "RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0,
+	"XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// IsCurrencyCode reports whether code has the shape of an ISO 4217 currency
+// code, three upper-case letters such as "EUR".
+func IsCurrencyCode(code string) bool {
+	return currencyCode.MatchString(code)
+}
+
+// Decimals returns the number of decimal places of the currency's minor unit.
+func Decimals(code string) int {
+	if digits, ok := minorDigits[code]; ok {
+		return digits
+	}
+	return 2
+}
+
+// IsSupportedCurrency reports whether amounts in the currency can be held in
+// a Money, which always has two decimal places. Currencies such as JPY or
+// KWD would be off by a factor of a hundred or ten.
+func IsSupportedCurrency(code string) bool {
+	return IsCurrencyCode(code) && Decimals(code) == 2
+}
+
+// Convert returns the amount in another currency given the exchange rate to
+// it, rounded half away from zero to the nearest minor unit. It returns
+// ErrOutOfRange if the result does not fit in a Money.
+func (m Money) Convert(rate float64) (Money, error) {
+	converted := math.Round(float64(m) * rate)
+	if math.IsNaN(converted) || math.Abs(converted) >= math.MaxInt64 {
+		return 0, ErrOutOfRange
+	}
+	return Money(converted), nil
+}
@@ -0,0 +1,57 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestIsSupportedCurrency(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"USD", true},
+		{"EUR", true},
+		{"GBP", true},
+		{"JPY", false},
+		{"KRW", false},
+		{"KWD", false},
+		{"BHD", false},
+		{"CLF", false},
+		{"usd", false},
+		{"EURO", false},
+	}
+	for _, tt := range tests {
+		if got := IsSupportedCurrency(tt.code); got != tt.want {
+			t.Errorf("IsSupportedCurrency(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount Money
+		rate   float64
+		want   Money
+	}{
+		{10000, 1, 10000},
+		{4500, 1.16, 5220},
+		{1, 0.5, 1},
+		{-1, 0.5, -1},
+		{333, 0.1, 33},
+		{1 << 53, 1, 1 << 53},
+	}
+	for _, tt := range tests {
+		got, err := tt.amount.Convert(tt.rate)
+		if err != nil || got != tt.want {
+			t.Errorf("Money(%d).Convert(%v) = %d, %v, want %d", tt.amount, tt.rate, got, err, tt.want)
+		}
+	}
+
+	for _, rate := range []float64{2, 1e10, math.Inf(1), math.NaN()} {
+		if got, err := Money(math.MaxInt64 / 2).Convert(rate); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("Money(MaxInt64/2).Convert(%v) = %d, %v, want ErrOutOfRange", rate, got, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package money provides an exact monetary amount type.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount stored as an integer number of minor units (cents), so
+// adding, subtracting and comparing amounts is always exact. It is encoded in
+// JSON as a decimal string such as "12.34" and stored in the database as an
+// INTEGER.
+type Money int64
+
+// Scale is the number of minor units in one major unit.
+const Scale = 100
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Parse reads a decimal amount such as "12", "-3.5" or "100.25". Amounts with
+// more than two decimal places are rejected rather than rounded.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(s, ".")
+	if whole == "" && (!hasPoint || frac == "") {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: %q has more than 2 decimal places", ErrInvalidAmount, s)
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	var units int64
+	if whole != "" {
+		var err error
+		units, err = strconv.ParseInt(whole, 10, 64)
+		if err != nil || units > math.MaxInt64/Scale-1 {
+			return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+		}
+	}
+	units *= Scale
+
+	frac += strings.Repeat("0", 2-len(frac))
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	units += cents
+
+	if negative {
+		units = -units
+	}
+	return Money(units), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromMinor returns the amount for a number of minor units.
+func FromMinor(units int64) Money {
+	return Money(units)
+}
+
+// Minor returns the amount as a number of minor units.
+func (m Money) Minor() int64 {
+	return int64(m)
+}
+
+// Abs returns the absolute value of the amount.
+func (m Money) Abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// String formats the amount with exactly two decimal places.
+func (m Money) String() string {
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units/Scale, units%Scale)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both decimal strings and plain JSON numbers. Numbers
+// are parsed from their literal text, so they never go through float64.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	parsed, err := Parse(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(math.Round(v))
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money.Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(text string) error {
+	units, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into money.Money: %v", text, err)
+	}
+	*m = Money(units)
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
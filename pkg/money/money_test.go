@@ -0,0 +1,136 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"0", 0},
+		{"12", 1200},
+		{"12.3", 1230},
+		{"12.34", 1234},
+		{"100.05", 10005},
+		{".5", 50},
+		{"5.", 500},
+		{"-.5", -50},
+		{"-3.5", -350},
+		{"+3.5", 350},
+		{"-0", 0},
+		{" 7.25 ", 725},
+		{"007.10", 710},
+		{"92233720368547757.99", 9223372036854775799},
+		{"-92233720368547757.99", -9223372036854775799},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) returned error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		".",
+		"-",
+		"+",
+		"-.",
+		"1.234",
+		"0.001",
+		"1.2.3",
+		"--1",
+		"+-1",
+		"1,50",
+		"1e3",
+		"abc",
+		"12a",
+		"1. 5",
+		"92233720368547758",
+		"99999999999999999999",
+		"-92233720368547758",
+	}
+	for _, in := range tests {
+		if got, err := Parse(in); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("Parse(%q) = %d, %v, want ErrInvalidAmount", in, got, err)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{1234, "12.34"},
+		{-100000, "-1000.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`"12.34"`, 1234},
+		{`12.34`, 1234},
+		{`12`, 1200},
+		{`-0.5`, -50},
+		{`".5"`, 50},
+		{`"5."`, 500},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s) returned error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	// Numbers are read from their literal text, so no float rounding slips in
+	for _, in := range []string{`12.345`, `"12.345"`, `0.1e1`, `true`, `"abc"`, `1e20`} {
+		var got Money
+		if err := json.Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("Unmarshal(%s) = %d, want an error", in, got)
+		}
+	}
+
+	got := Money(42)
+	if err := json.Unmarshal([]byte(`null`), &got); err != nil || got != 42 {
+		t.Errorf("Unmarshal(null) = %d, %v, want the value left alone", got, err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	for _, m := range []Money{0, 1, -1, 99, 12345, -987654321} {
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("Marshal(%d) returned error %v", m, err)
+		}
+		var got Money
+		if err := json.Unmarshal(data, &got); err != nil || got != m {
+			t.Errorf("round trip of %d through %s = %d, %v", m, data, got, err)
+		}
+	}
+}
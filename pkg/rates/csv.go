@@ -0,0 +1,74 @@
+package rates
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var csvColumns = []string{"date", "base", "quote", "rate"}
+
+// ParseCSV reads rates from a CSV file whose header names the date, base,
+// quote and rate columns, in any order:
+//
+//	date,base,quote,rate
+//	2024-01-02,EUR,USD,1.0956
+func ParseCSV(r io.Reader) ([]Rate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("rate file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, column := range csvColumns {
+		if _, ok := index[column]; !ok {
+			return nil, fmt.Errorf("header is missing the %q column", column)
+		}
+	}
+
+	var parsed []Rate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		date, err := parseDate(strings.TrimSpace(record[index["date"]]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(record[index["rate"]]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[index["rate"]])
+		}
+
+		rate := Rate{
+			Date:  date,
+			Base:  strings.ToUpper(strings.TrimSpace(record[index["base"]])),
+			Quote: strings.ToUpper(strings.TrimSpace(record[index["quote"]])),
+			Value: value,
+		}
+		if err := rate.Validate(); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		parsed = append(parsed, rate)
+	}
+
+	return parsed, nil
+}
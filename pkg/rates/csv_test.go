@@ -0,0 +1,80 @@
+package rates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func day(value string) time.Time {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		panic(err)
+	}
+	return date
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Rate
+	}{
+		{
+			name: "columns in the documented order",
+			in:   "date,base,quote,rate\n2024-01-02,EUR,USD,1.0956\n2024-01-02,EUR,JPY,155.73\n",
+			want: []Rate{
+				{Date: day("2024-01-02"), Base: "EUR", Quote: "USD", Value: 1.0956},
+				{Date: day("2024-01-02"), Base: "EUR", Quote: "JPY", Value: 155.73},
+			},
+		},
+		{
+			name: "columns in any order, spaces and case are ignored",
+			in:   "Rate, Quote, Date, Base\n 0.8612 , gbp, 2024-01-03 , usd\n",
+			want: []Rate{{Date: day("2024-01-03"), Base: "USD", Quote: "GBP", Value: 0.8612}},
+		},
+		{
+			name: "header only",
+			in:   "date,base,quote,rate\n",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCSV(strings.NewReader(tt.in))
+			if err != nil {
+				t.Fatalf("ParseCSV returned error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCSV = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{"empty file", "", "rate file is empty"},
+		{"missing column", "date,base,rate\n", `header is missing the "quote" column`},
+		{"bad date", "date,base,quote,rate\n02/01/2024,EUR,USD,1.1\n", `line 2: invalid date "02/01/2024", expected YYYY-MM-DD`},
+		{"bad rate", "date,base,quote,rate\n2024-01-02,EUR,USD,abc\n", `line 2: invalid rate "abc"`},
+		{"zero rate", "date,base,quote,rate\n2024-01-02,EUR,USD,0\n", "line 2: rate for EUR/USD must be greater than 0"},
+		{"same currency", "date,base,quote,rate\n2024-01-02,EUR,USD,1.1\n2024-01-02,EUR,eur,1\n", "line 3: EUR cannot be quoted against itself"},
+		{"unknown currency code", "date,base,quote,rate\n2024-01-02,EURO,USD,1.1\n", `line 2: invalid currency pair "EURO"/"USD"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCSV(strings.NewReader(tt.in))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseCSV error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
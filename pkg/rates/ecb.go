@@ -0,0 +1,61 @@
+package rates
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ecbBase is the currency every ECB reference rate is quoted against.
+const ecbBase = "EUR"
+
+// ecbEnvelope mirrors the layout of the ECB's eurofxref XML files, which
+// nest one Cube per day inside an outer Cube.
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECB reads rates from an ECB reference rate file, either the daily
+// eurofxref-daily.xml or the full eurofxref-hist.xml history. All of its
+// rates are quoted against the euro.
+func ParseECB(r io.Reader) ([]Rate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("invalid ECB rate file: %v", err)
+	}
+
+	var parsed []Rate
+	for _, day := range envelope.Days {
+		date, err := parseDate(day.Time)
+		if err != nil {
+			return nil, err
+		}
+		for _, quote := range day.Rates {
+			value, err := strconv.ParseFloat(quote.Rate, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid rate %q for %s", day.Time, quote.Rate, quote.Currency)
+			}
+
+			rate := Rate{
+				Date:  date,
+				Base:  ecbBase,
+				Quote: strings.ToUpper(quote.Currency),
+				Value: value,
+			}
+			if err := rate.Validate(); err != nil {
+				return nil, fmt.Errorf("%s: %v", day.Time, err)
+			}
+			parsed = append(parsed, rate)
+		}
+	}
+
+	return parsed, nil
+}
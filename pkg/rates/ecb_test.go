@@ -0,0 +1,77 @@
+package rates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const ecbHistory = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<gesmes:Sender>
+		<gesmes:name>European Central Bank</gesmes:name>
+	</gesmes:Sender>
+	<Cube>
+		<Cube time="2024-01-03">
+			<Cube currency="USD" rate="1.0919"/>
+			<Cube currency="JPY" rate="155.52"/>
+		</Cube>
+		<Cube time="2024-01-02">
+			<Cube currency="USD" rate="1.0956"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+func TestParseECB(t *testing.T) {
+	got, err := ParseECB(strings.NewReader(ecbHistory))
+	if err != nil {
+		t.Fatalf("ParseECB returned error %v", err)
+	}
+	want := []Rate{
+		{Date: day("2024-01-03"), Base: "EUR", Quote: "USD", Value: 1.0919},
+		{Date: day("2024-01-03"), Base: "EUR", Quote: "JPY", Value: 155.52},
+		{Date: day("2024-01-02"), Base: "EUR", Quote: "USD", Value: 1.0956},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseECB = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseECBInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{
+			name:    "not XML",
+			in:      "date,base,quote,rate",
+			wantErr: "invalid ECB rate file: EOF",
+		},
+		{
+			name:    "bad date",
+			in:      `<Envelope><Cube><Cube time="3 Jan 2024"><Cube currency="USD" rate="1.09"/></Cube></Cube></Envelope>`,
+			wantErr: `invalid date "3 Jan 2024", expected YYYY-MM-DD`,
+		},
+		{
+			name:    "bad rate",
+			in:      `<Envelope><Cube><Cube time="2024-01-03"><Cube currency="USD" rate="n/a"/></Cube></Cube></Envelope>`,
+			wantErr: `2024-01-03: invalid rate "n/a" for USD`,
+		},
+		{
+			name:    "euro against itself",
+			in:      `<Envelope><Cube><Cube time="2024-01-03"><Cube currency="eur" rate="1"/></Cube></Cube></Envelope>`,
+			wantErr: "2024-01-03: EUR cannot be quoted against itself",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseECB(strings.NewReader(tt.in))
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ParseECB error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Package rates reads exchange rates from files published offline, such as
+// the European Central Bank's reference rates, so they can be imported
+// without network access.
+package rates
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"expense-sharing-api/pkg/money"
+)
+
+// DateLayout is the format of the dates in rate files.
+const DateLayout = "2006-01-02"
+
+// Rate says that on Date one unit of Base bought Value units of Quote.
+type Rate struct {
+	Date  time.Time
+	Base  string
+	Quote string
+	Value float64
+}
+
+// Validate checks that the rate names two different currencies and is a
+// positive number.
+func (r Rate) Validate() error {
+	if !money.IsCurrencyCode(r.Base) || !money.IsCurrencyCode(r.Quote) {
+		return fmt.Errorf("invalid currency pair %q/%q", r.Base, r.Quote)
+	}
+	if r.Base == r.Quote {
+		return fmt.Errorf("%s cannot be quoted against itself", r.Base)
+	}
+	if !(r.Value > 0) || math.IsInf(r.Value, 0) {
+		return fmt.Errorf("rate for %s/%s must be greater than 0", r.Base, r.Quote)
+	}
+	return nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	date, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return date, nil
+}
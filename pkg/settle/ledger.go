@@ -0,0 +1,61 @@
+package settle
+
+import (
+	"expense-sharing-api/pkg/money"
+	"sort"
+)
+
+// Ledger accumulates every money movement of a group into a net position per
+// member: what they paid, minus what they owe, adjusted by settlements.
+type Ledger struct {
+	net map[int]money.Money
+}
+
+// NewLedger returns a ledger in which each of the given members starts with a
+// zero position, so they are reported even if they never took part in an
+// expense.
+func NewLedger(memberIDs ...int) *Ledger {
+	l := &Ledger{net: make(map[int]money.Money, len(memberIDs))}
+	for _, id := range memberIDs {
+		l.net[id] = 0
+	}
+	return l
+}
+
+// AddExpense credits each payer with what they paid and debits each
+// participant with their share.
+func (l *Ledger) AddExpense(paid, owed map[int]money.Money) {
+	for userID, amount := range paid {
+		l.net[userID] += amount
+	}
+	for userID, amount := range owed {
+		l.net[userID] -= amount
+	}
+}
+
+// AddSettlement records that payer paid payee back, which moves both of
+// them towards zero.
+func (l *Ledger) AddSettlement(payerID, payeeID int, amount money.Money) {
+	l.net[payerID] += amount
+	l.net[payeeID] -= amount
+}
+
+// Balances returns the net position of every member. A positive amount means
+// the member is owed money, a negative amount means they owe money.
+func (l *Ledger) Balances() map[int]money.Money {
+	balances := make(map[int]money.Money, len(l.net))
+	for userID, amount := range l.net {
+		balances[userID] = amount
+	}
+	return balances
+}
+
+// Members returns the IDs of every member in the ledger in ascending order.
+func (l *Ledger) Members() []int {
+	ids := make([]int, 0, len(l.net))
+	for userID := range l.net {
+		ids = append(ids, userID)
+	}
+	sort.Ints(ids)
+	return ids
+}
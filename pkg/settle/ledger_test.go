@@ -0,0 +1,87 @@
+package settle
+
+import (
+	"expense-sharing-api/pkg/money"
+	"reflect"
+	"testing"
+)
+
+func TestLedger(t *testing.T) {
+	type expense struct {
+		paid, owed map[int]money.Money
+	}
+	type settlement struct {
+		payerID, payeeID int
+		amount           money.Money
+	}
+
+	tests := []struct {
+		name        string
+		members     []int
+		expenses    []expense
+		settlements []settlement
+		want        map[int]money.Money
+	}{
+		{
+			name:    "members start at zero",
+			members: []int{1, 2, 3},
+			want:    map[int]money.Money{1: 0, 2: 0, 3: 0},
+		},
+		{
+			name:    "payer is owed what the others consumed",
+			members: []int{1, 2, 3},
+			expenses: []expense{
+				{paid: map[int]money.Money{1: 9000}, owed: map[int]money.Money{1: 3000, 2: 3000, 3: 3000}},
+			},
+			want: map[int]money.Money{1: 6000, 2: -3000, 3: -3000},
+		},
+		{
+			name:    "several payers",
+			members: []int{1, 2, 3},
+			expenses: []expense{
+				{paid: map[int]money.Money{1: 6000, 2: 3000}, owed: map[int]money.Money{1: 3000, 2: 3000, 3: 3000}},
+			},
+			want: map[int]money.Money{1: 3000, 2: 0, 3: -3000},
+		},
+		{
+			name:    "settlements move both sides towards zero",
+			members: []int{1, 2, 3},
+			expenses: []expense{
+				{paid: map[int]money.Money{1: 9000}, owed: map[int]money.Money{1: 3000, 2: 3000, 3: 3000}},
+			},
+			settlements: []settlement{{payerID: 2, payeeID: 1, amount: 3000}, {payerID: 3, payeeID: 1, amount: 1000}},
+			want:        map[int]money.Money{1: 2000, 2: 0, 3: -2000},
+		},
+		{
+			name:    "former members keep their position",
+			members: []int{1},
+			expenses: []expense{
+				{paid: map[int]money.Money{4: 2000}, owed: map[int]money.Money{1: 1000, 4: 1000}},
+			},
+			want: map[int]money.Money{1: -1000, 4: 1000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := NewLedger(tt.members...)
+			for _, e := range tt.expenses {
+				ledger.AddExpense(e.paid, e.owed)
+			}
+			for _, s := range tt.settlements {
+				ledger.AddSettlement(s.payerID, s.payeeID, s.amount)
+			}
+			if got := ledger.Balances(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Balances() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLedgerMembers(t *testing.T) {
+	ledger := NewLedger(3, 1)
+	ledger.AddExpense(map[int]money.Money{5: 1000}, map[int]money.Money{2: 1000})
+	if got, want := ledger.Members(), []int{1, 2, 3, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Members() = %v, want %v", got, want)
+	}
+}
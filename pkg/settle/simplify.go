@@ -0,0 +1,100 @@
+// Package settle turns per-member net balances into a short list of
+// transfers that settles a group.
+package settle
+
+import (
+	"expense-sharing-api/pkg/money"
+	"sort"
+)
+
+// Transfer is a single payment of Amount from one member to another.
+type Transfer struct {
+	From   int         `json:"from"`
+	To     int         `json:"to"`
+	Amount money.Money `json:"amount"`
+}
+
+type position struct {
+	userID int
+	amount money.Money
+}
+
+// Simplify returns the transfers that settle the given net balances. A
+// positive balance means the member is owed money, a negative one means the
+// member owes money. Balances are expected to sum to zero; anything left over
+// once either side runs out stays unsettled.
+//
+// Members whose debt exactly matches another member's credit are paired
+// first, after which the largest debtor repeatedly pays the largest creditor.
+// This is not guaranteed to be the global minimum (that problem is NP-hard)
+// but never needs more than n-1 transfers and is deterministic for a given
+// input. A settled group gets an empty, non-nil list.
+func Simplify(balances map[int]money.Money) []Transfer {
+	var debtors, creditors []position
+	for userID, amount := range balances {
+		switch {
+		case amount < 0:
+			debtors = append(debtors, position{userID: userID, amount: -amount})
+		case amount > 0:
+			creditors = append(creditors, position{userID: userID, amount: amount})
+		}
+	}
+	sortPositions(debtors)
+	sortPositions(creditors)
+
+	transfers := []Transfer{}
+
+	// Settle exact matches first, each of them closes two positions at once
+	for i := range debtors {
+		for j := range creditors {
+			if creditors[j].amount != 0 && debtors[i].amount == creditors[j].amount {
+				transfers = append(transfers, Transfer{From: debtors[i].userID, To: creditors[j].userID, Amount: debtors[i].amount})
+				debtors[i].amount = 0
+				creditors[j].amount = 0
+				break
+			}
+		}
+	}
+	debtors = compact(debtors)
+	creditors = compact(creditors)
+
+	// Greedily match the largest remaining debtor with the largest creditor
+	for len(debtors) > 0 && len(creditors) > 0 {
+		debtor, creditor := &debtors[0], &creditors[0]
+		amount := debtor.amount
+		if creditor.amount < amount {
+			amount = creditor.amount
+		}
+		transfers = append(transfers, Transfer{From: debtor.userID, To: creditor.userID, Amount: amount})
+		debtor.amount -= amount
+		creditor.amount -= amount
+
+		debtors = compact(debtors)
+		creditors = compact(creditors)
+		sortPositions(debtors)
+		sortPositions(creditors)
+	}
+
+	return transfers
+}
+
+// sortPositions orders positions by descending amount, then by user ID so
+// the result does not depend on map iteration order.
+func sortPositions(positions []position) {
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].amount != positions[j].amount {
+			return positions[i].amount > positions[j].amount
+		}
+		return positions[i].userID < positions[j].userID
+	})
+}
+
+func compact(positions []position) []position {
+	kept := positions[:0]
+	for _, p := range positions {
+		if p.amount != 0 {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,116 @@
+package settle
+
+import (
+	"expense-sharing-api/pkg/money"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances map[int]money.Money
+		want     []Transfer
+	}{
+		{
+			name:     "nil input",
+			balances: nil,
+			want:     []Transfer{},
+		},
+		{
+			name:     "settled group",
+			balances: map[int]money.Money{1: 0, 2: 0, 3: 0},
+			want:     []Transfer{},
+		},
+		{
+			name:     "single debt",
+			balances: map[int]money.Money{1: 1500, 2: -1500},
+			want:     []Transfer{{From: 2, To: 1, Amount: 1500}},
+		},
+		{
+			// Greedy matching alone would need four transfers here
+			name:     "exact matches are paired first",
+			balances: map[int]money.Money{1: -4000, 2: -3000, 3: 3000, 4: 2500, 5: 1500},
+			want: []Transfer{
+				{From: 2, To: 3, Amount: 3000},
+				{From: 1, To: 4, Amount: 2500},
+				{From: 1, To: 5, Amount: 1500},
+			},
+		},
+		{
+			name:     "largest debtor pays largest creditor",
+			balances: map[int]money.Money{1: 6000, 2: 1000, 3: -4000, 4: -3000},
+			want: []Transfer{
+				{From: 3, To: 1, Amount: 4000},
+				{From: 4, To: 1, Amount: 2000},
+				{From: 4, To: 2, Amount: 1000},
+			},
+		},
+		{
+			name:     "ties are broken by user ID",
+			balances: map[int]money.Money{4: 1000, 3: 1000, 2: -1000, 1: -1000},
+			want: []Transfer{
+				{From: 1, To: 3, Amount: 1000},
+				{From: 2, To: 4, Amount: 1000},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Map iteration order varies between runs, the result must not
+			for i := 0; i < 20; i++ {
+				got := Simplify(tt.balances)
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("Simplify(%v) = %v, want %v", tt.balances, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSimplifyTransferBound(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for run := 0; run < 500; run++ {
+		members := 2 + random.Intn(10)
+		balances := make(map[int]money.Money, members)
+		var total money.Money
+		for userID := 1; userID < members; userID++ {
+			amount := money.Money(random.Intn(20001) - 10000)
+			balances[userID] = amount
+			total += amount
+		}
+		balances[members] = -total
+
+		nonZero := 0
+		for _, amount := range balances {
+			if amount != 0 {
+				nonZero++
+			}
+		}
+
+		transfers := Simplify(balances)
+		if nonZero > 0 && len(transfers) > nonZero-1 {
+			t.Fatalf("Simplify(%v) needed %d transfers for %d members", balances, len(transfers), nonZero)
+		}
+
+		remaining := make(map[int]money.Money, members)
+		for userID, amount := range balances {
+			remaining[userID] = amount
+		}
+		for _, transfer := range transfers {
+			if transfer.Amount <= 0 {
+				t.Fatalf("Simplify(%v) produced non-positive transfer %v", balances, transfer)
+			}
+			remaining[transfer.From] += transfer.Amount
+			remaining[transfer.To] -= transfer.Amount
+		}
+		for userID, amount := range remaining {
+			if amount != 0 {
+				t.Fatalf("Simplify(%v) left user %d at %v", balances, userID, amount)
+			}
+		}
+	}
+}
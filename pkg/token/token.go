@@ -0,0 +1,17 @@
+// Package token generates the random secrets handed out in invitations and
+// join links.
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// Generate returns a random, URL-safe token carrying 192 bits of entropy.
+func Generate() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}